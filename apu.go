@@ -4,7 +4,8 @@ package vcsgo
 
 type apu struct {
 	// not marshalled in snapshot
-	buffer apuCircleBuf
+	buffer     apuCircleBuf
+	sampleRate int
 
 	FreqClk int
 
@@ -19,17 +20,19 @@ type apu struct {
 }
 
 func (apu *apu) init(emu *emuState) {
-	if emu.TIA.TVFormat == FormatPAL {
-		f := palClocksPerSecond / samplesPerSecond
-		apu.ClocksPerSample = int(f)
-	} else {
-		f := ntscClocksPerSecond / samplesPerSecond
-		apu.ClocksPerSample = int(f)
-	}
+	apu.setClocksPerSample(emu.TIA.TVFormat)
 	apu.Channel0.init()
 	apu.Channel1.init()
 }
 
+func (apu *apu) setClocksPerSample(format TVFormat) {
+	if format == FormatPAL {
+		apu.ClocksPerSample = int(palClocksPerSecond / float64(apu.sampleRate))
+	} else {
+		apu.ClocksPerSample = int(ntscClocksPerSecond / float64(apu.sampleRate))
+	}
+}
+
 type sound struct {
 	Volume  byte
 	FreqDiv byte
@@ -147,8 +150,7 @@ func (s *sound) run9BitPoly() int {
 
 const (
 	amountGenerateAhead = 16 * 512 * 2 // must be power of 2
-	samplesPerSecond    = 44100
-	timePerSample       = 1.0 / samplesPerSecond
+	defaultSampleRate   = 44100
 )
 
 const apuCircleBufSize = amountGenerateAhead
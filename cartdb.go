@@ -0,0 +1,150 @@
+package vcsgo
+
+import (
+	"crypto/md5"
+	"fmt"
+)
+
+// ControllerType is what's plugged into a controller port
+type ControllerType byte
+
+const (
+	// ControllerAuto means the controller isn't known, so
+	// it's guessed from how the game reads the ports
+	ControllerAuto ControllerType = iota
+	// ControllerJoystick is the standard joystick
+	ControllerJoystick
+	// ControllerPaddles is a pair of paddles
+	ControllerPaddles
+	// ControllerKeypad is a 12-button keypad/keyboard controller
+	ControllerKeypad
+)
+
+// CartProperties holds what's known about a particular cart
+type CartProperties struct {
+	Name   string
+	Mapper string
+
+	// TVFormat is only used if TVFormatKnown is set,
+	// otherwise it's detected by running the cart.
+	TVFormat      TVFormat
+	TVFormatKnown bool
+
+	LeftController  ControllerType
+	RightController ControllerType
+
+	// true is the A (or "pro") position
+	LeftDifficultyA  bool
+	RightDifficultyA bool
+
+	// PaddleMin and PaddleMax are the range of scanlines
+	// the full turn of a paddle charges its pot over. Zero
+	// for both means the default range.
+	PaddleMin int16
+	PaddleMax int16
+
+	// DisplayStartLine is the scanline after VSYNC that
+	// appears at the top of the screen. Zero means default.
+	DisplayStartLine int
+}
+
+func lookupCartProperties(rom []byte) (CartProperties, bool) {
+	props, ok := cartPropertiesDB[fmt.Sprintf("%x", md5.Sum(rom))]
+	return props, ok
+}
+
+// NOTE: seeded from the old md5 mapper lists, which are for
+// mappers that are no longer used and are tough to add to
+// heuristics without stepping on other mappers (or are tough
+// to use heuristics on). Entries for other per-game quirks
+// (e.g. paddle and keypad games, so they don't need to be
+// guessed at as they run) go here as well.
+
+var cartPropertiesDB = map[string]CartProperties{
+	// Parker Brothers (E0)
+	"27c6a2ca16ad7d814626ceea62fa8fb4": {Name: "Frogger II (NTSC)", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"fb91dfc36cddaa54b09924ae8fd96199": {Name: "Frogger II (PAL)", Mapper: "E0", TVFormat: FormatPAL, TVFormatKnown: true},
+
+	"b311ab95e85bc0162308390728a7361d": {Name: "Gyruss (NTSC)", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"e600f5e98a20fafa47676198efe6834d": {Name: "Gyruss (PAL)", Mapper: "E0", TVFormat: FormatPAL, TVFormatKnown: true},
+
+	"e51030251e440cffaab1ac63438b44ae": {Name: "James Bond 007 (NTSC)", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+
+	"e24d7d879281ffec0641e9c3f52e505a": {Name: "Lord of the Rings (Prototype)", Mapper: "E0"},
+
+	"3347a6dd59049b15a38394aa2dafa585": {Name: "Montezuma's Revenge (NTSC)", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"9f59eddf9ba91a7d93bce7ee4b7693bc": {Name: "Montezuma's Revenge (PAL) (Hack)", Mapper: "E0", TVFormat: FormatPAL, TVFormatKnown: true},
+
+	"b7a7e34e304e4b7bc565ec01ba33ea27": {Name: "Mr. Do's Castle (NTSC)", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+
+	"c7f13ef38f61ee2367ada94fdcc6d206": {Name: "Popeye (NTSC)", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"e9cb18770a41a16de63b124c1e8bd493": {Name: "Popeye (PAL)", Mapper: "E0", TVFormat: FormatPAL, TVFormatKnown: true},
+
+	"72b8dc752befbfb3ffda120eb98b2dd0": {Name: "Q-bert's Qubes (NTSC)", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"517592e6e0c71731019c0cebc2ce044f": {Name: "Q-bert's Qubes (NTSC) [a1]", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+
+	"5336f86f6b982cc925532f2e80aa1e17": {Name: "Star Wars - Death Star Battle (NTSC)", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"cb9b2e9806a7fbab3d819cfe15f0f05a": {Name: "Star Wars - Death Star Battle (PAL)", Mapper: "E0", TVFormat: FormatPAL, TVFormatKnown: true},
+
+	"c246e05b52f68ab2e9aee40f278cd158": {Name: "Star Wars - Ewok Adventure (Prototype) (NTSC) (Hack)", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"6dfad2dd2c7c16ac0fa257b6ce0be2f0": {Name: "Star Wars - Ewok Adventure (Prototype) (PAL)", Mapper: "E0", TVFormat: FormatPAL, TVFormatKnown: true},
+
+	"6339d28c9a7f92054e70029eb0375837": {Name: "Star Wars - The Arcade Game (NTSC)", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"6cf054cd23a02e09298d2c6f787eb21d": {Name: "Star Wars - The Arcade Game (PAL)", Mapper: "E0", TVFormat: FormatPAL, TVFormatKnown: true},
+	"6651e2791d38edc02c5a5fd7b47a1627": {Name: "Star Wars - The Arcade Game (NTSC) (Prototype)", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+
+	"c29f8db680990cb45ef7fef6ab57a2c2": {Name: "Super Cobra (NTSC)", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"d326db524d93fa2897ab69c42d6fb698": {Name: "Super Cobra (PAL)", Mapper: "E0", TVFormat: FormatPAL, TVFormatKnown: true},
+
+	"fa2be8125c3c60ab83e1c0fe56922fcb": {Name: "Tooth Protectors (NTSC)", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+
+	"085322bae40d904f53bdcc56df0593fc": {Name: "Tutankham (NTSC)", Mapper: "E0", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"66c2380c71709efa7b166621e5bb4558": {Name: "Tutankham (PAL)", Mapper: "E0", TVFormat: FormatPAL, TVFormatKnown: true},
+
+	// M Network (E7)
+	"76f53abbbf39a0063f24036d6ee0968a": {Name: "Bump 'n' Jump (NTSC)", Mapper: "E7", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"4dbf47c7f5ac767a3b07843a530d29a5": {Name: "Breaking News (Hack)", Mapper: "E7"},
+
+	"0443cfa9872cdb49069186413275fa21": {Name: "Burgertime (NTSC)", Mapper: "E7", TVFormat: FormatNTSC, TVFormatKnown: true},
+
+	"3b76242691730b2dd22ec0ceab351bc6": {Name: "Masters of the Universe (NTSC)", Mapper: "E7", TVFormat: FormatNTSC, TVFormatKnown: true},
+
+	// Activision (FE)
+	"ac7c2260378975614192ca2bc3d20e0b": {Name: "Decathalon (NTSC)", Mapper: "FE", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"883258dcd68cefc6cd4d40b1185116dc": {Name: "Decathalon (PAL)", Mapper: "FE", TVFormat: FormatPAL, TVFormatKnown: true},
+
+	"4f618c2429138e0280969193ed6c107e": {Name: "Robot Tank (NTSC)", Mapper: "FE", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"f687ec4b69611a7f78bd69b8a567937a": {Name: "Robot Tank (PAL)", Mapper: "FE", TVFormat: FormatPAL, TVFormatKnown: true},
+	"fbb0151ea2108e33b2dbaae14a1831dd": {Name: "Robot Tank TV (Hack)", Mapper: "FE"},
+
+	"c032c2bd7017fdfbba9a105ec50f800e": {Name: "Thwocker (Prototype)", Mapper: "FE"},
+
+	// Pitfall 2 (DPC)
+	"448c2a175afc8df174d6ff4cce12c794": {Name: "Pitfall 2 (NTSC)", Mapper: "DPC", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"e34c236630c945089fcdef088c4b6e06": {Name: "Pitfall 2 (PAL)", Mapper: "DPC", TVFormat: FormatPAL, TVFormatKnown: true},
+	"39a6a5a2e1f6297cceaa48bb03af02e9": {Name: "Pitfall 2 (Hack)", Mapper: "DPC"},
+
+	// CommaVid (CV)
+	"497f3d2970c43e5224be99f75e97cbbb": {Name: "Video Life (NTSC)", Mapper: "CV", TVFormat: FormatNTSC, TVFormatKnown: true},
+	"cddabfd68363a76cd30bee4e8094c646": {Name: "Magicard (NTSC)", Mapper: "CV", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerKeypad},
+
+	// Paddles
+	"5b124850de9eea66781a50b2e9837000": {Name: "Bachelor Party (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerPaddles},
+	"59f596285d174233c84597dee6f34f1f": {Name: "Beat 'Em & Eat 'Em (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerPaddles},
+	"f34f08e5eb96e500e851a80be3277a56": {Name: "Breakout (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerPaddles},
+	"feedcc20bc3ca34851cd5d9e38aa2ca6": {Name: "Canyon Bomber (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerPaddles},
+	"a7b584937911d60c120677fe0d47f36f": {Name: "Circus Atari (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerPaddles},
+	"42b2c3b4545f1499a083cfbc4a3b7640": {Name: "Eggomania (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerPaddles},
+	"4b27f5397c442d25f0c418ccdacf1926": {Name: "Encounter at L-5 (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerPaddles},
+	"5428cdfada281c569c74c7308c7f2c26": {Name: "Kaboom! (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerPaddles},
+	"392f00fd1a074a3c15bc96b0a57d52a1": {Name: "Night Driver (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerPaddles},
+	"6ff4156d10b357f61f09820d03c0f852": {Name: "Street Racer (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerPaddles, RightController: ControllerPaddles},
+	"8885d0ce11c5b40c3a8a8d9ed28cefef": {Name: "Super Breakout (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerPaddles},
+	"d45ebf130ed9070ea8ebd56176e48a38": {Name: "Tac-Scan (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerPaddles},
+	"60e0ea3cbe0913d39803477945e9e5ec": {Name: "Video Olympics (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerPaddles, RightController: ControllerPaddles},
+	"cbe5a166550a8129a5e6d374901dffad": {Name: "Warlords (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerPaddles, RightController: ControllerPaddles},
+
+	// Keypads
+	"9f48eeb47836cf145a15771775f0767a": {Name: "Basic Programming (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerKeypad, RightController: ControllerKeypad},
+	"cbd981a23c592fb9ab979223bb368cd5": {Name: "Star Raiders (NTSC)", TVFormat: FormatNTSC, TVFormatKnown: true, LeftController: ControllerJoystick, RightController: ControllerKeypad},
+}
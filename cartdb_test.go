@@ -0,0 +1,38 @@
+package vcsgo
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestCartPropertiesDB(t *testing.T) {
+	for sum, props := range cartPropertiesDB {
+		if b, err := hex.DecodeString(sum); err != nil || len(b) != 16 || hex.EncodeToString(b) != sum {
+			t.Errorf("%v: key %q isn't a lowercase md5", props.Name, sum)
+		}
+		if props.Mapper != "" {
+			if _, err := findMapperName(props.Mapper); err != nil {
+				t.Errorf("%v: %v", props.Name, err)
+			}
+		}
+		for _, c := range []ControllerType{props.LeftController, props.RightController} {
+			if c > ControllerKeypad {
+				t.Errorf("%v: unknown controller type %d", props.Name, c)
+			}
+		}
+	}
+}
+
+// Known paddle and keypad carts don't wait on the heuristics
+func TestKnownControllersSkipHeuristics(t *testing.T) {
+	emu := &emuState{}
+	emu.setControllers(ControllerPaddles, ControllerAuto)
+	if !emu.ControllersKnown || !emu.InputPotsBeingUsed {
+		t.Errorf("paddles: known %v, pots used %v", emu.ControllersKnown, emu.InputPotsBeingUsed)
+	}
+	emu = &emuState{}
+	emu.setControllers(ControllerJoystick, ControllerKeypad)
+	if !emu.ControllersKnown || emu.InputPotsBeingUsed || !emu.EverSelectedKeypad1 {
+		t.Errorf("keypad: known %v, pots used %v, keypad %v", emu.ControllersKnown, emu.InputPotsBeingUsed, emu.EverSelectedKeypad1)
+	}
+}
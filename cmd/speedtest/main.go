@@ -20,7 +20,8 @@ func main() {
 	cartBytes, err := ioutil.ReadFile(cartFilename)
 	dieIf(err)
 
-	emu := vcsgo.NewEmulator(cartBytes, false)
+	emu, err := vcsgo.NewEmulator(cartBytes, false)
+	dieIf(err)
 	emu.SetDebugContinue(true)
 
 	testSpeed(emu)
@@ -34,6 +35,7 @@ func testSpeed(emu vcsgo.Emulator) {
 	for {
 		emu.SetInput(nullInput)
 		emu.Step()
+		dieIf(emu.Err())
 		emu.FlipRequested()
 		steps++
 
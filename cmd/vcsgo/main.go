@@ -5,25 +5,57 @@ import (
 	"github.com/theinternetftw/vcsgo"
 	"github.com/theinternetftw/vcsgo/profiling"
 
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"time"
+	"unicode"
 )
 
 func main() {
 
 	defer profiling.Start().Stop()
 
-	assert(len(os.Args) == 2, "usage: ./vcsgo ROM_FILENAME")
-	cartFilename := os.Args[1]
+	mapperName := flag.String("mapper", "", "force the cart's mapper, one of: "+strings.Join(vcsgo.MapperNames(), " "))
+	movieFilename := flag.String("movie", "", "play back a movie recorded with F5")
+	hideComb := flag.Bool("hidecomb", false, "hide the black HMOVE lines at the left edge of the screen")
+	randBits := flag.Bool("randbits", false, "read undriven TIA bits as random noise, to catch games that depend on them")
+	flag.Parse()
+
+	assert(flag.NArg() == 1, "usage: ./vcsgo [-mapper NAME] [-movie FILE] [-hidecomb] [-randbits] ROM_FILENAME")
+	cartFilename := flag.Arg(0)
 
 	cartBytes, err := ioutil.ReadFile(cartFilename)
 	dieIf(err)
 
 	devMode := fileExists("devmode")
+	logLevel := vcsgo.LogInfo
+	if devMode {
+		logLevel = vcsgo.LogDebug
+	}
 
-	emu := vcsgo.NewEmulator(cartBytes, devMode)
+	emu, err := vcsgo.NewEmulatorWithOptions(cartBytes, vcsgo.Options{
+		DevMode:       devMode,
+		Mapper:        *mapperName,
+		HideHMoveComb: *hideComb,
+		SampleRate:    44100,
+		Logger:        vcsgo.NewTextLogger(os.Stdout, logLevel),
+
+		RandomizeUndrivenTIABits: *randBits,
+
+		// ten seconds or so, for hold-to-rewind
+		RewindCapacity: 600,
+	})
+	dieIf(err)
+
+	if *movieFilename != "" {
+		movie, err := ioutil.ReadFile(*movieFilename)
+		dieIf(err)
+		emu, err = emu.PlayMovie(movie)
+		dieIf(err)
+	}
 
 	screenW := 320
 	screenH := 264
@@ -78,6 +110,7 @@ func startEmu(filename string, window *glimmer.WindowState, emu vcsgo.Emulator)
 	lastInputPollTime := time.Now()
 
 	snapshotPrefix := filename + ".snapshot"
+	movieFilename := filename + ".movie"
 
 	audio, audioErr := glimmer.OpenAudioBuffer(glimmer.OpenAudioBufferOptions{
 		OutputBufDuration: 25 * time.Millisecond,
@@ -97,8 +130,21 @@ func startEmu(filename string, window *glimmer.WindowState, emu vcsgo.Emulator)
 
 	snapshotMode := 'x'
 
+	recording := false
+	lastMovieKey := false
+	rewinding := false
+	lastRewindTime := time.Time{}
+
 	newInput := vcsgo.Input{}
 
+	// the difficulty switches start where the cart DB says
+	// (B if it doesn't know the cart) and are toggled by F3/F4
+	cartProps, _ := emu.CartProperties()
+	leftDifficultyA := cartProps.LeftDifficultyA
+	rightDifficultyA := cartProps.RightDifficultyA
+	lastLeftDifficultyKey := false
+	lastRightDifficultyKey := false
+
 	for {
 
 		now := time.Now()
@@ -117,17 +163,50 @@ func startEmu(filename string, window *glimmer.WindowState, emu vcsgo.Emulator)
 
 				cid := func(c glimmer.KeyCode) bool { return window.CodeIsDown(c) }
 
+				movieKey := cid(glimmer.KeyCodeF5)
+				if movieKey && !lastMovieKey {
+					if recording {
+						err := ioutil.WriteFile(movieFilename, emu.StopMovieRecording(), os.FileMode(0644))
+						if err != nil {
+							fmt.Println("failed to write movie:", err)
+						} else {
+							fmt.Println("wrote movie to", movieFilename)
+						}
+					} else {
+						emu.StartMovieRecording()
+						fmt.Println("recording movie!")
+					}
+					recording = !recording
+				}
+				lastMovieKey = movieKey
+
+				rewinding = cid(glimmer.KeyCodeBackspace)
+
 				newInput.ResetButton = cid(glimmer.KeyCodeF1)
 				newInput.SelectButton = cid(glimmer.KeyCodeF2)
 
+				leftDifficultyKey := cid(glimmer.KeyCodeF3)
+				if leftDifficultyKey && !lastLeftDifficultyKey {
+					leftDifficultyA = !leftDifficultyA
+				}
+				lastLeftDifficultyKey = leftDifficultyKey
+				rightDifficultyKey := cid(glimmer.KeyCodeF4)
+				if rightDifficultyKey && !lastRightDifficultyKey {
+					rightDifficultyA = !rightDifficultyA
+				}
+				lastRightDifficultyKey = rightDifficultyKey
+				newInput.P0DifficultySwitch = leftDifficultyA
+				newInput.P1DifficultySwitch = rightDifficultyA
+
 				newInput.JoyP0.Up = cid(glimmer.KeyCodeW)
 				newInput.JoyP0.Down = cid(glimmer.KeyCodeS)
 				newInput.JoyP0.Left = cid(glimmer.KeyCodeA)
 				newInput.JoyP0.Right = cid(glimmer.KeyCodeD)
 				newInput.JoyP0.Button = cid(glimmer.KeyCodeJ)
 
-				// TODO: switch between input methods (arg switch, plus
-				//  about 20 MD5s for the games that use paddles)
+				// NOTE: paddles and joysticks share keys, the emu
+				// picks which one to use from the cart DB (or by
+				// watching the game for unknown carts).
 				if cid(glimmer.KeyCodeA) {
 					paddles[0].left(inputDt)
 				} else if cid(glimmer.KeyCodeD) {
@@ -152,6 +231,14 @@ func startEmu(filename string, window *glimmer.WindowState, emu vcsgo.Emulator)
 					cid(glimmer.KeyCodeV), cid(glimmer.KeyCodeB), cid(glimmer.KeyCodeN),
 				}
 
+				for code, r := range glimmer.KeyCodeToUnshiftedAsciiMap {
+					if cid(code) {
+						newInput.CompuMate.SetKey(byte(unicode.ToUpper(r)), true)
+					}
+				}
+				newInput.CompuMate.Func = cid(glimmer.KeyCodeControl)
+				newInput.CompuMate.Shift = cid(glimmer.KeyCodeShift)
+
 				if window.CodeIsDown(glimmer.KeyCodeArrowLeft) {
 					paddles[1].left(inputDt)
 				} else if window.CodeIsDown(glimmer.KeyCodeArrowRight) {
@@ -212,11 +299,29 @@ func startEmu(filename string, window *glimmer.WindowState, emu vcsgo.Emulator)
 						continue
 					}
 					emu = newEmu
+					if recording {
+						fmt.Println("movie recording stopped by snapshot load")
+						recording = false
+					}
+				}
+			}
+		}
+
+		if rewinding {
+			if now.Sub(lastRewindTime) >= time.Second/60 {
+				lastRewindTime = now
+				if emu.StepBack() {
+					window.RenderMutex.Lock()
+					copy(window.Pix, emu.Framebuffer())
+					window.RenderMutex.Unlock()
 				}
 			}
+			time.Sleep(time.Millisecond)
+			continue
 		}
 
 		emu.Step()
+		dieIf(emu.Err())
 
 		if emu.GetSoundBufferUsed() >= audioToGen {
 			if cap(workingAudioBuffer) < audioToGen {
@@ -0,0 +1,136 @@
+package vcsgo
+
+import "bytes"
+
+// The Spectravideo CompuMate is a keyboard computer add-on: a
+// 16K cart, 2K of RAM, and a membrane keyboard wired into both
+// controller ports. Everything is driven through SWCHA outputs:
+//   D6: clock the keyboard's column counter (on rising edge)
+//   D5: reset the column counter / RAM write enable
+//   D4: RAM disable (0 = RAM at 0x1800-0x1fff)
+//   D1-D0: 4K ROM bank
+// The keyboard is a 4x10 matrix. The selected column's rows are
+// read back on INPT4 (row 0), SWCHA D2 (row 1), INPT5 (row 2)
+// and SWCHA D3 (row 3), all active low. FUNC and SHIFT pull the
+// INPT0 and INPT3 pots high.
+
+// CompuMateLayout gives the key at each row and column of the
+// CompuMate keyboard matrix, '\n' for ENTER.
+var CompuMateLayout = [4][10]byte{
+	{'7', '6', '8', '5', '9', '4', '0', '3', '1', '2'},
+	{'U', 'Y', 'I', 'T', 'O', 'R', 'P', 'E', 'Q', 'W'},
+	{'J', 'H', 'K', 'G', 'L', 'F', '\n', 'D', 'A', 'S'},
+	{'M', 'N', ',', 'B', '.', 'V', ' ', 'C', 'Z', 'X'},
+}
+
+// CompuMateKeyboard is the state of the CompuMate keyboard.
+// Keys is laid out like CompuMateLayout.
+type CompuMateKeyboard struct {
+	Keys  [4][10]bool
+	Func  bool
+	Shift bool
+}
+
+// SetKey sets the state of the key with the character c
+// from CompuMateLayout.
+func (k *CompuMateKeyboard) SetKey(c byte, down bool) {
+	for row := range CompuMateLayout {
+		for col := range CompuMateLayout[row] {
+			if CompuMateLayout[row][col] == c {
+				k.Keys[row][col] = down
+			}
+		}
+	}
+}
+
+type mapperCM struct {
+	SWCHA  byte
+	Column byte
+	RAM    [2048]byte
+}
+
+// There's only the one CompuMate cart, 16K, and its code is
+// full of STA $F3FF,X and STA $F400,Y. Stella spots it by a
+// couple of either of those, so do the same.
+func isCM(rom []byte) bool {
+	if len(rom) != 16*1024 {
+		return false
+	}
+	return bytes.Count(rom, []byte{0x9d, 0xff, 0xf3}) >= 2 || // STA $F3FF,X
+		bytes.Count(rom, []byte{0x99, 0x00, 0xf4}) >= 2 // STA $F400,Y
+}
+
+func (m *mapperCM) bank() int        { return int(m.SWCHA & 3) }
+func (m *mapperCM) ramEnabled() bool { return m.SWCHA&0x10 == 0 }
+
+func (m *mapperCM) read(mem *mem, addr uint16) byte {
+	addr &= 0x1fff
+	if addr >= 0x1800 && m.ramEnabled() {
+		return m.RAM[addr&0x7ff]
+	}
+	return mem.rom[m.bank()*4096+int(addr&0xfff)]
+}
+func (m *mapperCM) write(mem *mem, addr uint16, val byte) {
+	addr &= 0x1fff
+	if addr >= 0x1800 && m.ramEnabled() && m.SWCHA&0x20 != 0 {
+		m.RAM[addr&0x7ff] = val
+	}
+}
+
+func (m *mapperCM) writeSWCHA(val byte) {
+	if val&0x20 != 0 {
+		m.Column = 0
+	}
+	if val&0x40 != 0 && m.SWCHA&0x40 == 0 {
+		m.Column = (m.Column + 1) % 10
+	}
+	m.SWCHA = val
+}
+
+func (m *mapperCM) getMapperNum() uint16   { return 0xcc }
+func (m *mapperCM) getBankNum() uint16     { return uint16(m.bank()) }
+func (m *mapperCM) runCycle(emu *emuState) {}
+
+// starts in the last bank with RAM off
+func (m *mapperCM) init(emu *emuState) {
+	m.SWCHA = 0xff
+}
+
+// compuMateInput replaces what the controller ports would
+// return with what the keyboard drives onto them.
+func (emu *emuState) compuMateInput(cm *mapperCM, addr uint16, val byte) byte {
+	kb := &emu.Input.CompuMate
+	keyDown := func(row int) bool { return kb.Keys[row][cm.Column] }
+
+	if addr&0x1280 == 0x0280 {
+		if addr&0x7 == 0 { // SWCHA
+			in := byte(0xff)
+			if keyDown(1) {
+				in &^= 0x04
+			}
+			if keyDown(3) {
+				in &^= 0x08
+			}
+			ddr := emu.DDRModeMaskPortA
+			val = cm.SWCHA&ddr | in&^ddr
+		}
+		return val
+	}
+	if addr&0x1080 == 0 {
+		switch addr & 0x0f {
+		case 0x08:
+			val = val&0x7f | boolBit(7, kb.Func)
+		case 0x09:
+			val = val&0x7f | 0x80
+		case 0x0a:
+			val &= 0x7f
+		case 0x0b:
+			val = val&0x7f | boolBit(7, kb.Shift)
+		case 0x0c:
+			val = val&0x7f | boolBit(7, !keyDown(0))
+		case 0x0d:
+			val = val&0x7f | boolBit(7, !keyDown(2))
+		}
+	}
+	return val
+}
@@ -1,9 +1,18 @@
 package vcsgo
 
+import (
+	"errors"
+	"os"
+)
+
 // Emulator exposes the public facing fns for an emulation session
 type Emulator interface {
 	Step()
 
+	// Err returns the error that halted emulation, if any.
+	// Once set, Step does nothing.
+	Err() error
+
 	MakeSnapshot() []byte
 	LoadSnapshot([]byte) (Emulator, error)
 
@@ -15,10 +24,33 @@ type Emulator interface {
 
 	SetInput(input Input)
 
+	// StartMovieRecording starts recording a movie of the
+	// session from this point on. StopMovieRecording ends
+	// it and returns the movie file, or nil if there wasn't
+	// a recording going.
+	StartMovieRecording()
+	StopMovieRecording() []byte
+
+	// PlayMovie returns an emulator that replays a movie made
+	// from the same cart. While it's playing (MoviePlaying), its
+	// input comes from the movie, not SetInput.
+	PlayMovie(movie []byte) (Emulator, error)
+	MoviePlaying() bool
+
+	// StepBack rewinds to the last kept state from before the
+	// current frame (see Options.RewindCapacity), returning false
+	// if there isn't one. It does nothing while a movie is playing
+	// or being recorded.
+	StepBack() bool
+
 	SetDebugContinue(b bool)
 
 	GetTVFormat() TVFormat
 
+	// CartProperties returns what the cart DB knows about
+	// the loaded cart, if anything.
+	CartProperties() (CartProperties, bool)
+
 	SetDevMode(b bool)
 	InDevMode() bool
 }
@@ -54,6 +86,8 @@ type Input struct {
 
 	Keypad0 [12]bool
 	Keypad1 [12]bool
+
+	CompuMate CompuMateKeyboard
 }
 
 // Joystick represents the buttons on a joystick
@@ -72,13 +106,172 @@ type Paddle struct {
 	Position int16
 }
 
+// SetInput is ignored while a movie is playing
 func (emu *emuState) SetInput(input Input) {
+	if emu.moviePlayer != nil {
+		return
+	}
+	if emu.movieRecorder != nil {
+		emu.movieRecorder.record(emu, input)
+	}
 	emu.setInput(input)
 }
 
-// NewEmulator creates an emulation session
-func NewEmulator(cart []byte, devMode bool) Emulator {
-	return newState(cart, devMode)
+// Errors that halt emulation (see Emulator.Err), or that stop a
+// cart from being loaded at all. Returned errors wrap these with
+// more detail, so check them with errors.Is.
+var (
+	// ErrBadROM is for carts that can't be a ROM image at all
+	ErrBadROM = errors.New("bad rom")
+	// ErrUnsupportedMapper is for carts whose bankswitching
+	// scheme isn't supported (or can't be figured out)
+	ErrUnsupportedMapper = errors.New("unsupported mapper")
+	// ErrCPUJam is for when the CPU hits a KIL/JAM opcode, which
+	// locks up real hardware until reset
+	ErrCPUJam = errors.New("cpu jammed")
+	// ErrUnimplemented is for things the hardware does that
+	// the emulator doesn't (e.g. an undocumented opcode)
+	ErrUnimplemented = errors.New("unimplemented")
+)
+
+// NewEmulator creates an emulation session. Along with ROM
+// images, cart can be a WAV recording of a Supercharger tape.
+// Carts found in the cart DB are set up from their properties.
+func NewEmulator(cart []byte, devMode bool) (Emulator, error) {
+	emu, err := newState(cart, Options{
+		DevMode: devMode,
+		Logger:  NewTextLogger(os.Stdout, LogInfo),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return emu, nil
+}
+
+// Options are the settings for NewEmulatorWithOptions. The
+// zero value gives the same setup NewEmulator does, minus
+// the printing to stdout.
+type Options struct {
+	DevMode bool
+
+	// Seed seeds the emulator's RNG, which is used for power
+	// on state (RAM, the timer, CPU regs) and anything else the
+	// hardware leaves to chance. The same seed gives the same
+	// run every time, and the RNG is kept in snapshots.
+	Seed int64
+
+	// RandomizeCPU starts the CPU's regs with random values,
+	// as on real hardware, instead of zeros.
+	RandomizeCPU bool
+
+	// RandomizeUndrivenTIABits makes the bits the TIA leaves
+	// floating on reads come from the RNG, not from what was last
+	// on the data bus. Games that lean on those bits by mistake
+	// then act up, as they can on real consoles. Snapshots and
+	// movies keep the setting they were made with.
+	RandomizeUndrivenTIABits bool
+
+	// RAMInit is how RAM starts out. RAMPattern is repeated
+	// over RAM for RAMInitPattern.
+	RAMInit    RAMInit
+	RAMPattern []byte
+
+	// TVFormat is used as is if ForceTVFormat is set.
+	// Otherwise the cart DB is checked, and failing that
+	// a few frames are run to detect it (unless that's
+	// skipped, leaving it to be detected as the game runs).
+	TVFormat           TVFormat
+	ForceTVFormat      bool
+	SkipTVFormatDetect bool
+
+	// LeftController and RightController override the cart
+	// DB, unless both are ControllerAuto.
+	LeftController  ControllerType
+	RightController ControllerType
+
+	// Mapper pins the cart's bankswitching scheme, e.g. "F8SC"
+	// or "3E" (see MapperNames). Empty means autodetect.
+	Mapper string
+
+	// HideHMoveComb draws the 8 pixels that HMOVE blanks at
+	// the left edge of a line (the "comb") as playfield and
+	// background, for those who'd rather not see it.
+	HideHMoveComb bool
+
+	// SampleRate is the rate of the sound from ReadSoundBuffer.
+	// Zero means 44100hz.
+	SampleRate int
+
+	// RewindCapacity is how many states StepBack can go back
+	// through, kept every RewindInterval frames (or every frame
+	// if zero). Zero capacity turns rewind off.
+	RewindCapacity int
+	RewindInterval int
+
+	// Logger gets the emulator's diagnostic messages (see
+	// NewTextLogger). If nil, they're dropped.
+	Logger Logger
+}
+
+// RAMInit is a policy for filling RAM at power on
+type RAMInit byte
+
+const (
+	// RAMInitRandom fills RAM from the seeded RNG, as real
+	// hardware powers on with junk in RAM
+	RAMInitRandom RAMInit = iota
+	// RAMInitZero clears RAM
+	RAMInitZero
+	// RAMInitPattern repeats Options.RAMPattern over RAM
+	RAMInitPattern
+)
+
+// NewEmulatorWithOptions is NewEmulator with more control
+// over how the cart is set up.
+func NewEmulatorWithOptions(cart []byte, opts Options) (Emulator, error) {
+	emu, err := newState(cart, opts)
+	if err != nil {
+		return nil, err
+	}
+	return emu, nil
+}
+
+// ParseMapperName checks a mapper name, returning its canonical
+// form (e.g. "f8sc" becomes "F8SC", "tigervision" becomes "3F").
+func ParseMapperName(name string) (string, error) {
+	m, err := findMapperName(name)
+	if err != nil {
+		return "", err
+	}
+	return m.name, nil
+}
+
+// MapperGuess is a guess at a cart's mapper, with a confidence
+// from 0 to 1.
+type MapperGuess struct {
+	Name       string
+	Confidence float64
+}
+
+// GuessMapper scans a ROM for signs of each mapper, returning
+// the ones that fit, most likely first.
+func GuessMapper(rom []byte) []MapperGuess {
+	return scanForMapper(rom)
+}
+
+// MapperNames lists the canonical names of all supported mappers
+func MapperNames() []string {
+	names := make([]string, len(mapperNames))
+	for i := range mapperNames {
+		names[i] = mapperNames[i].name
+	}
+	return names
+}
+
+// DecodeSuperchargerTape decodes a WAV recording of a Supercharger
+// tape into the multi-load ROM image format (N * 8448 bytes).
+func DecodeSuperchargerTape(wav []byte) ([]byte, error) {
+	return decodeARTape(wav)
 }
 
 func (emu *emuState) MakeSnapshot() []byte {
@@ -89,6 +282,33 @@ func (emu *emuState) LoadSnapshot(snapBytes []byte) (Emulator, error) {
 	return emu.loadSnapshot(snapBytes)
 }
 
+func (emu *emuState) StartMovieRecording() {
+	emu.startMovieRecording()
+}
+
+func (emu *emuState) StopMovieRecording() []byte {
+	return emu.stopMovieRecording()
+}
+
+func (emu *emuState) PlayMovie(movie []byte) (Emulator, error) {
+	newEmu, err := emu.playMovie(movie)
+	if err != nil {
+		return nil, err
+	}
+	return newEmu, nil
+}
+
+func (emu *emuState) MoviePlaying() bool {
+	return emu.moviePlaying()
+}
+
+func (emu *emuState) StepBack() bool {
+	if emu.rewind == nil || emu.moviePlayer != nil || emu.movieRecorder != nil {
+		return false
+	}
+	return emu.rewind.stepBack(emu)
+}
+
 func (emu *emuState) Framebuffer() []byte {
 	return emu.framebuffer()
 }
@@ -107,11 +327,20 @@ func (emu *emuState) Step() {
 	emu.step()
 }
 
+func (emu *emuState) Err() error {
+	return emu.err
+}
+
 func (emu *emuState) GetTVFormat() TVFormat {
 	return emu.TIA.TVFormat
 }
 
-// ReadSoundBuffer returns a 44100hz * 16bit * 2ch sound buffer.
+func (emu *emuState) CartProperties() (CartProperties, bool) {
+	return emu.cartProps, emu.cartPropsKnown
+}
+
+// ReadSoundBuffer returns a 16bit * 2ch sound buffer, at 44100hz
+// or the sample rate set in Options.
 // A pre-sized buffer must be provided, which is returned resized
 // if the buffer was less full than the length requested.
 func (emu *emuState) ReadSoundBuffer(toFill []byte) []byte {
@@ -0,0 +1,104 @@
+package vcsgo
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// LogLevel is how much a log message matters
+type LogLevel byte
+
+const (
+	// LogDebug is for details only useful when digging into a cart
+	LogDebug LogLevel = iota
+	// LogInfo is for things found out about a cart as it runs
+	LogInfo
+	// LogWarn is for things that are likely emulated wrong
+	LogWarn
+	// LogError is for things that halt emulation
+	LogError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "debug"
+	case LogInfo:
+		return "info"
+	case LogWarn:
+		return "warn"
+	case LogError:
+		return "error"
+	}
+	return fmt.Sprintf("level%d", byte(l))
+}
+
+// LogCategory is the part of the emulator a log message is from
+type LogCategory string
+
+// The categories used by the emulator
+const (
+	LogCart   LogCategory = "cart"
+	LogMapper LogCategory = "mapper"
+	LogTIA    LogCategory = "tia"
+	LogInput  LogCategory = "input"
+	LogCPU    LogCategory = "cpu"
+	LogMem    LogCategory = "mem"
+)
+
+// Logger takes an emulator's diagnostic messages. Each emulator
+// only calls its Logger from the goroutine running it.
+type Logger interface {
+	Log(level LogLevel, category LogCategory, msg string)
+}
+
+// NewTextLogger returns a Logger that writes messages of at
+// least minLevel to w, one per line. It's safe to share one
+// between emulators.
+func NewTextLogger(w io.Writer, minLevel LogLevel) Logger {
+	return &textLogger{w: w, minLevel: minLevel}
+}
+
+type textLogger struct {
+	mutex    sync.Mutex
+	w        io.Writer
+	minLevel LogLevel
+}
+
+func (t *textLogger) Log(level LogLevel, category LogCategory, msg string) {
+	if level < t.minLevel {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	fmt.Fprintf(t.w, "[%s] %s: %s\n", level, category, msg)
+}
+
+// logSink is one emulator's connection to its Logger, shared by
+// the parts of the emulator that log. Not marshalled in snapshots,
+// so it's handed over when one is loaded.
+type logSink struct {
+	logger Logger
+	warned map[string]bool
+}
+
+func newLogSink(logger Logger) *logSink {
+	return &logSink{logger: logger, warned: map[string]bool{}}
+}
+
+func (l *logSink) logf(level LogLevel, category LogCategory, format string, args ...interface{}) {
+	if l == nil || l.logger == nil {
+		return
+	}
+	l.logger.Log(level, category, fmt.Sprintf(format, args...))
+}
+
+// warnOnce logs a warning the first time it comes up
+func (l *logSink) warnOnce(category LogCategory, msg string) {
+	if l == nil || l.warned[msg] {
+		return
+	}
+	l.warned[msg] = true
+	l.logf(LogWarn, category, "%s", msg)
+}
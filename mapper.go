@@ -1,6 +1,7 @@
 package vcsgo
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 )
@@ -16,28 +17,65 @@ type mapper interface {
 	init(emu *emuState)
 }
 
+// busWatcher is for mappers with hotspots below 0x1000, outside
+// of cart space. They get to see every access that isn't theirs,
+// along with the value read or written.
+type busWatcher interface {
+	watchBus(mem *mem, addr uint16, val byte)
+}
+
 type marshalledMapper struct {
 	Number uint16
 	Data   []byte
 }
 
 func unmarshalMapper(m marshalledMapper) (mapper, error) {
+	mapper, err := newMapperFromNum(m.Number)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(m.Data, &mapper); err != nil {
+		return nil, err
+	}
+	return mapper, nil
+}
+
+// newMapperFromNum makes an empty mapper to unmarshal state into
+func newMapperFromNum(num uint16) (mapper, error) {
 	var mapper mapper
-	switch m.Number {
+	switch num {
 	case 0x00:
 		mapper = &mapperUnknown{}
+	case 0x07:
+		mapper = &mapperX07{}
+	case 0x3e:
+		mapper = &mapper3E{}
 	case 0x3f:
 		mapper = &mapper3F{}
+	case 0x5b:
+		mapper = &mapperSB{}
 	case 0x66:
 		mapper = &mapper66{}
+	case 0xbf:
+		mapper = makeMapperBF()
 	case 0xc0:
 		mapper = &mapperC0{}
+	case 0xcc:
+		mapper = &mapperCM{}
+	case 0xcdf:
+		mapper = &cdf{}
 	case 0xdc:
 		mapper = makeMapperDC()
+	case 0xdd:
+		mapper = &dpcPlus{}
+	case 0xdf:
+		mapper = makeMapperDF()
 	case 0xe0:
 		mapper = &mapperE0{}
 	case 0xe7:
 		mapper = &mapperE7{}
+	case 0xef:
+		mapper = makeMapperEF()
 	case 0xf0:
 		mapper = &mapperF0{}
 	case 0xf4:
@@ -50,11 +88,28 @@ func unmarshalMapper(m marshalledMapper) (mapper, error) {
 		mapper = &mapperFA{}
 	case 0xfe:
 		mapper = &mapperFE{}
+	case 0x13e:
+		mapper = &mapper3EPlus{}
+	case 0x1bf:
+		mapper = makeMapperBFSC()
+	case 0x1df:
+		mapper = makeMapperDFSC()
+	case 0x1ef:
+		mapper = makeMapperEFSC()
+	case 0x1f4:
+		mapper = makeMapperF4SC()
+	case 0x1f6:
+		mapper = makeMapperF6SC()
+	case 0x1f8:
+		mapper = makeMapperF8SC()
+	case 0x220:
+		mapper = &mapperUA{}
+	case 0x840:
+		mapper = &mapper0840{}
+	case 0x4a50:
+		mapper = &mapper4A50{}
 	default:
-		return nil, fmt.Errorf("state contained unknown mapper number 0x%04x", m.Number)
-	}
-	if err := json.Unmarshal(m.Data, &mapper); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("state contained unknown mapper number 0x%04x", num)
 	}
 	return mapper, nil
 }
@@ -70,6 +125,9 @@ func marshalMapper(mapper mapper) marshalledMapper {
 	}
 }
 
+// The superchip is 128 bytes of RAM, written through 0x1000-0x107f
+// and read through 0x1080-0x10ff. Activated is set for carts that
+// have one, which is decided when the mapper is made.
 type superchip struct {
 	RAM       [128]byte
 	Activated bool
@@ -77,21 +135,17 @@ type superchip struct {
 
 // NOTE: assumes addr already limited to 0x1000-0x10ff
 func (s *superchip) read(addr uint16) byte {
-	var val byte
 	if addr >= 0x1080 {
-		val = s.RAM[addr-0x1080]
-	} else {
-		s.RAM[addr-0x1000] = 0xff // write garbage
+		return s.RAM[addr-0x1080]
 	}
-	return val
+	// reading the write port still writes, with whatever
+	// was left on the bus. Here that's always 0xff.
+	s.RAM[addr-0x1000] = 0xff
+	return 0xff
 }
 
 // NOTE: assumes addr already limited to 0x1000-0x107f
 func (s *superchip) write(addr uint16, val byte) {
-	if !s.Activated {
-		fmt.Println("activating superchip!")
-		s.Activated = true
-	}
 	s.RAM[addr-0x1000] = val
 }
 
@@ -118,11 +172,13 @@ func (m *mapperUnknown) getBankNum() uint16     { return 0 }
 func (m *mapperUnknown) runCycle(emu *emuState) {}
 func (m *mapperUnknown) init(emu *emuState)     {}
 
+// mapperStd covers the schemes that bankswitch on reading or
+// writing a run of hotspot addrs at the end of each bank, with
+// or without a superchip.
 type mapperStd struct {
 	MapperNum    uint16
 	BankNum      uint16
 	Superchip    superchip
-	NoSuperchip  bool
 	CtrlAddrLow  uint16
 	CtrlAddrHigh uint16
 }
@@ -133,7 +189,7 @@ func (m *mapperStd) read(mem *mem, addr uint16) byte {
 	if m.Superchip.Activated && addr >= 0x1000 && addr <= 0x10ff {
 		val = m.Superchip.read(addr)
 	} else {
-		val = mem.rom[m.BankNum*4096+(addr&0xfff)]
+		val = mem.rom[int(m.BankNum)*4096+int(addr&0xfff)]
 	}
 	if addr >= m.CtrlAddrLow && addr <= m.CtrlAddrHigh {
 		m.BankNum = addr - m.CtrlAddrLow
@@ -142,7 +198,7 @@ func (m *mapperStd) read(mem *mem, addr uint16) byte {
 }
 func (m *mapperStd) write(mem *mem, addr uint16, val byte) {
 	addr &= 0x1fff
-	if !m.NoSuperchip && addr >= 0x1000 && addr <= 0x107f {
+	if m.Superchip.Activated && addr >= 0x1000 && addr <= 0x107f {
 		m.Superchip.write(addr, val)
 	} else if addr >= m.CtrlAddrLow && addr <= m.CtrlAddrHigh {
 		m.BankNum = addr - m.CtrlAddrLow
@@ -153,28 +209,36 @@ func (m *mapperStd) getBankNum() uint16     { return m.BankNum }
 func (m *mapperStd) runCycle(emu *emuState) {}
 func (m *mapperStd) init(emu *emuState)     {}
 
-func makeMapperF8() mapper {
-	return &mapperStd{
-		MapperNum: 0xf8, CtrlAddrLow: 0x1ff8, CtrlAddrHigh: 0x1ff9,
-	}
-}
-func makeMapperF8NoSC() mapper {
-	return &mapperStd{
-		MapperNum: 0xf8, CtrlAddrLow: 0x1ff8, CtrlAddrHigh: 0x1ff9,
-		NoSuperchip: true,
+// the SC versions of each scheme set the 0x100 bit of the
+// mapper num.
+func makeMapperStd(mapperNum, ctrlAddrLow, ctrlAddrHigh uint16, hasSuperchip bool) *mapperStd {
+	m := &mapperStd{
+		MapperNum:    mapperNum,
+		CtrlAddrLow:  ctrlAddrLow,
+		CtrlAddrHigh: ctrlAddrHigh,
+		Superchip:    superchip{Activated: hasSuperchip},
 	}
-}
-func makeMapperF6() mapper {
-	return &mapperStd{
-		MapperNum: 0xf6, CtrlAddrLow: 0x1ff6, CtrlAddrHigh: 0x1ff9,
-	}
-}
-func makeMapperF4() mapper {
-	return &mapperStd{
-		MapperNum: 0xf4, CtrlAddrLow: 0x1ff4, CtrlAddrHigh: 0x1ffb,
+	if hasSuperchip {
+		m.MapperNum |= 0x100
 	}
+	return m
 }
 
+func makeMapperF8() mapper   { return makeMapperStd(0xf8, 0x1ff8, 0x1ff9, false) }
+func makeMapperF8SC() mapper { return makeMapperStd(0xf8, 0x1ff8, 0x1ff9, true) }
+func makeMapperF6() mapper   { return makeMapperStd(0xf6, 0x1ff6, 0x1ff9, false) }
+func makeMapperF6SC() mapper { return makeMapperStd(0xf6, 0x1ff6, 0x1ff9, true) }
+func makeMapperF4() mapper   { return makeMapperStd(0xf4, 0x1ff4, 0x1ffb, false) }
+func makeMapperF4SC() mapper { return makeMapperStd(0xf4, 0x1ff4, 0x1ffb, true) }
+
+// EF, DF and BF are the F4 idea stretched to 16, 32 and 64 banks.
+func makeMapperEF() mapper   { return makeMapperStd(0xef, 0x1fe0, 0x1fef, false) }
+func makeMapperEFSC() mapper { return makeMapperStd(0xef, 0x1fe0, 0x1fef, true) }
+func makeMapperDF() mapper   { return makeMapperStd(0xdf, 0x1fc0, 0x1fdf, false) }
+func makeMapperDFSC() mapper { return makeMapperStd(0xdf, 0x1fc0, 0x1fdf, true) }
+func makeMapperBF() mapper   { return makeMapperStd(0xbf, 0x1f80, 0x1fbf, false) }
+func makeMapperBFSC() mapper { return makeMapperStd(0xbf, 0x1f80, 0x1fbf, true) }
+
 type mapperFA struct {
 	BankNum   uint16
 	MapperRAM [256]byte
@@ -283,7 +347,7 @@ func (m *mapper3F) read(mem *mem, addr uint16) byte {
 func (m *mapper3F) write(mem *mem, addr uint16, val byte) {
 	addr &= 0x1fff
 	if addr >= 0 && addr <= 0x3f {
-		m.BankNum = uint16(val)
+		m.BankNum = uint16(val) % uint16(len(mem.rom)/2048)
 	}
 }
 func (m *mapper3F) getMapperNum() uint16   { return 0x3f }
@@ -291,6 +355,105 @@ func (m *mapper3F) getBankNum() uint16     { return m.BankNum }
 func (m *mapper3F) runCycle(emu *emuState) {}
 func (m *mapper3F) init(emu *emuState)     {}
 
+// 3E is 3F plus up to 32K of RAM. Writing to 0x3e puts a 1K RAM
+// bank in the lower slot (read at 0x1000, written at 0x1400),
+// writing to 0x3f puts a ROM bank back.
+type mapper3E struct {
+	ROMBank     uint16
+	RAMBank     uint16
+	RAMSelected bool
+	RAM         [32 * 1024]byte
+}
+
+func (m *mapper3E) read(mem *mem, addr uint16) byte {
+	addr &= 0x1fff
+	if addr >= 0x1800 {
+		romLen := len(mem.rom)
+		return mem.rom[romLen-2048+int(addr&0x7ff)]
+	}
+	if !m.RAMSelected {
+		return mem.rom[int(m.ROMBank)*2048+int(addr&0x7ff)]
+	}
+	if addr < 0x1400 {
+		return m.RAM[m.RAMBank*1024+(addr&0x3ff)]
+	}
+	m.RAM[m.RAMBank*1024+(addr&0x3ff)] = 0xff // trash ram
+	return 0
+}
+func (m *mapper3E) write(mem *mem, addr uint16, val byte) {
+	addr &= 0x1fff
+	switch {
+	case addr == 0x003e:
+		m.RAMBank = uint16(val) % 32
+		m.RAMSelected = true
+	case addr == 0x003f:
+		m.ROMBank = uint16(val) % uint16(len(mem.rom)/2048)
+		m.RAMSelected = false
+	case m.RAMSelected && addr >= 0x1400 && addr < 0x1800:
+		m.RAM[m.RAMBank*1024+(addr&0x3ff)] = val
+	}
+}
+func (m *mapper3E) getMapperNum() uint16 { return 0x3e }
+func (m *mapper3E) getBankNum() uint16 {
+	if m.RAMSelected {
+		return m.RAMBank | 0x8000
+	}
+	return m.ROMBank
+}
+func (m *mapper3E) runCycle(emu *emuState) {}
+func (m *mapper3E) init(emu *emuState)     {}
+
+// 3E+ splits the cart space into four 1K slots. Writes to 0x3f
+// (ROM) or 0x3e (RAM) pick the bank in the low 6 bits and the
+// slot in the top 2. RAM banks are 512 bytes, read in the low
+// half of the slot and written in the high half.
+type mapper3EPlus struct {
+	Banks     [4]uint16
+	SlotIsRAM [4]bool
+	RAM       [32 * 1024]byte
+}
+
+func is3EPlus(rom []byte) bool {
+	return bytes.Contains(rom, []byte("TJ3E"))
+}
+
+func (m *mapper3EPlus) read(mem *mem, addr uint16) byte {
+	addr &= 0x1fff
+	if addr < 0x1000 {
+		return 0
+	}
+	slot := (addr >> 10) & 3
+	if !m.SlotIsRAM[slot] {
+		return mem.rom[int(m.Banks[slot])*1024+int(addr&0x3ff)]
+	}
+	if addr&0x200 == 0 {
+		return m.RAM[m.Banks[slot]*512+(addr&0x1ff)]
+	}
+	m.RAM[m.Banks[slot]*512+(addr&0x1ff)] = 0xff // trash ram
+	return 0
+}
+func (m *mapper3EPlus) write(mem *mem, addr uint16, val byte) {
+	addr &= 0x1fff
+	slot := (addr >> 10) & 3
+	switch {
+	case addr == 0x003e:
+		m.Banks[val>>6] = uint16(val & 0x3f)
+		m.SlotIsRAM[val>>6] = true
+	case addr == 0x003f:
+		m.Banks[val>>6] = uint16(val&0x3f) % uint16(len(mem.rom)/1024)
+		m.SlotIsRAM[val>>6] = false
+	case addr >= 0x1000 && m.SlotIsRAM[slot] && addr&0x200 != 0:
+		m.RAM[m.Banks[slot]*512+(addr&0x1ff)] = val
+	}
+}
+func (m *mapper3EPlus) getMapperNum() uint16   { return 0x13e }
+func (m *mapper3EPlus) getBankNum() uint16     { return m.Banks[0] }
+func (m *mapper3EPlus) runCycle(emu *emuState) {}
+
+// all slots start out as ROM bank 0, so that's where the
+// reset vector lives
+func (m *mapper3EPlus) init(emu *emuState) {}
+
 type mapperC0 struct {
 	RAM [1024]byte
 }
@@ -380,260 +543,3 @@ func (m *mapperE7) getMapperNum() uint16   { return 0xe7 }
 func (m *mapperE7) getBankNum() uint16     { return m.BankNum }
 func (m *mapperE7) runCycle(emu *emuState) {}
 func (m *mapperE7) init(emu *emuState)     {}
-
-const dpcROMEnd = 8192 + 2048 - 1
-
-type dpc struct {
-	MapperF8   mapper
-	Ptrs       [8]dpcPtr
-	LFSR       byte
-	Oscillator byte
-	OscCounter byte
-}
-
-type dpcPtr struct {
-	Ptr       uint16
-	ShowStart byte
-	ShowEnd   byte
-	Show      bool
-	MusicMode bool
-}
-
-func (d *dpc) readLFSR() byte {
-	val := d.LFSR
-	d.LFSR = val<<1 | (^(val>>7 ^ val>>5 ^ val>>4 ^ val>>3) & 1)
-	return val
-}
-
-var warnOnceMap = map[string]bool{}
-
-func warnOnce(msg string) {
-	if _, ok := warnOnceMap[msg]; ok {
-		return
-	}
-	warnOnceMap[msg] = true
-	fmt.Println(msg)
-}
-
-func makeMapperDC() mapper {
-	return &dpc{MapperF8: makeMapperF8NoSC()}
-}
-func (d *dpc) read(mem *mem, addr uint16) byte {
-	// TODO: add dpc mirrors at 0x1800 (p2 doesn't use it)
-	addr &= 0x1fff
-	if addr >= 0x1000 && addr <= 0x1003 {
-		return d.readLFSR()
-	} else if addr >= 0x1004 && addr <= 0x1007 {
-		return d.getMusic()
-	} else if addr >= 0x1008 && addr <= 0x100F {
-		return d.Ptrs[addr-0x1008].read(mem)
-	} else if addr >= 0x1010 && addr <= 0x1017 {
-		return d.Ptrs[addr-0x1010].readMasked(mem)
-	} else if addr >= 0x1018 && addr <= 0x101F {
-		warnOnce("DPC - 0x1018 NOT IMPL!")
-	} else if addr >= 0x1020 && addr <= 0x1027 {
-		warnOnce("DPC - 0x1020 NOT IMPL!")
-	} else if addr >= 0x1028 && addr <= 0x102F {
-		warnOnce("DPC - 0x1028 NOT IMPL!")
-	} else if addr >= 0x1030 && addr <= 0x1037 {
-		warnOnce("DPC - 0x1030 NOT IMPL!")
-	} else if addr >= 0x1038 && addr <= 0x103f {
-		warnOnce("DPC - 0x1038 NOT IMPL!")
-	} else if addr >= 0x1070 && addr <= 0x1077 {
-		d.LFSR = 0
-	}
-	return d.MapperF8.read(mem, addr)
-}
-
-func (d *dpc) write(mem *mem, addr uint16, val byte) {
-	// TODO: add dpc mirrors at 0x1800 (p2 doesn't use it)
-	addr &= 0x1fff
-	if addr >= 0x1040 && addr <= 0x1047 {
-		d.Ptrs[addr-0x1040].setShowStart(val)
-	} else if addr >= 0x1048 && addr <= 0x104f {
-		d.Ptrs[addr-0x1048].setShowEnd(val)
-	} else if addr >= 0x1050 && addr <= 0x1057 {
-		d.Ptrs[addr-0x1050].setLo(val)
-	} else if addr >= 0x1058 && addr <= 0x105c {
-		d.Ptrs[addr-0x1058].setHi(val)
-	} else if addr >= 0x105d && addr <= 0x105f {
-		d.Ptrs[addr-0x1058].setHi(val)
-		d.Ptrs[addr-0x1058].MusicMode = val&0x10 != 0 || val&0x20 != 0
-	} else if addr >= 0x1060 && addr <= 0x1067 {
-		if val != 0 {
-			warnOnce("DPC - 0x1060 NOT IMPL!")
-		}
-	} else if addr >= 0x1068 && addr <= 0x106f {
-		// not used
-	} else if addr >= 0x1070 && addr <= 0x1077 {
-		d.LFSR = 0
-	} else if addr >= 0x1078 && addr <= 0x107f {
-		// not used
-	} else {
-		d.MapperF8.write(mem, addr, val)
-	}
-}
-
-func (d *dpc) getMapperNum() uint16 { return 0xdc }
-func (d *dpc) getBankNum() uint16   { return d.MapperF8.getBankNum() }
-func (d *dpc) runCycle(emu *emuState) {
-	if d.OscCounter++; d.OscCounter == 60 {
-		d.OscCounter = 0
-		for i := range d.Ptrs {
-			p := &d.Ptrs[i]
-			if p.MusicMode {
-				p.updateMask()
-				p.Ptr--
-				if p.Ptr&0xff == 0xff {
-					p.setLo(p.ShowStart)
-				}
-			}
-		}
-	}
-}
-func (d *dpc) init(emu *emuState) {}
-
-var dpcMusicMixer = [8]byte{0, 4, 5, 9, 6, 10, 11, 15}
-
-func (d *dpc) getMusic() byte {
-	selector := d.Ptrs[5].getChannel()<<2 | d.Ptrs[6].getChannel()<<1 | d.Ptrs[7].getChannel()
-	val := dpcMusicMixer[selector]
-	return val
-}
-
-func (p *dpcPtr) getChannel() byte {
-	if p.MusicMode && p.Show {
-		return 1
-	}
-	return 0
-}
-func (p *dpcPtr) read(mem *mem) byte {
-	p.updateMask()
-	val := mem.rom[dpcROMEnd-(p.Ptr&0x7ff)]
-	p.Ptr--
-	return val
-}
-func (p *dpcPtr) readMasked(mem *mem) byte {
-	p.updateMask()
-	val := byte(0)
-	if p.Show {
-		val = mem.rom[dpcROMEnd-(p.Ptr&0x7ff)]
-	}
-	p.Ptr--
-	return val
-}
-func (p *dpcPtr) updateMask() {
-	if byte(p.Ptr) == p.ShowStart {
-		p.Show = true
-	} else if byte(p.Ptr) == p.ShowEnd {
-		p.Show = false
-	}
-}
-func (p *dpcPtr) setLo(lo byte) {
-	p.Ptr &= 0xff00
-	p.Ptr |= uint16(lo)
-}
-func (p *dpcPtr) setHi(hi byte) {
-	p.Ptr &= 0x00ff
-	p.Ptr |= uint16(hi&0x0f) << 8
-}
-func (p *dpcPtr) setShowStart(val byte) {
-	p.ShowStart = val
-	p.Show = false
-}
-func (p *dpcPtr) setShowEnd(val byte) {
-	p.ShowEnd = val
-	p.Show = false
-}
-
-type mapper66 struct {
-	BankCtrl    byte
-	WriteEnable bool
-	ROMEnable   bool
-
-	RAM [6 * 1024]byte
-
-	ByteReg        byte
-	ByteRegLatched bool
-
-	LastAddr   uint16
-	InWriteSeq bool
-	AddrCycles byte
-}
-
-var mapper66BankTable = [2][8]uint16{
-	{2, 0, 2, 0, 2, 1, 2, 1},
-	{3, 3, 0, 2, 3, 3, 1, 2},
-}
-
-func (m *mapper66) read(mem *mem, addr uint16) byte {
-	addr &= 0x1fff
-
-	bankSlot := addr / 0x1800
-	bank := mapper66BankTable[bankSlot][m.BankCtrl]
-	offset := [2]uint16{0x1000, 0x1800}[bankSlot]
-
-	if bank == 3 {
-		emuErr("0x1000-0x1800 - ROM requested and not impld")
-	}
-
-	if m.InWriteSeq {
-		if m.LastAddr != addr {
-			m.AddrCycles++
-		}
-		if m.AddrCycles == 5 && m.WriteEnable {
-			m.RAM[bank*2048+addr-offset] = m.ByteReg
-		}
-		if m.AddrCycles >= 5 {
-			m.InWriteSeq = false
-		}
-	}
-	m.LastAddr = addr
-
-	if addr >= 0x1000 && addr <= 0x10ff {
-		m.ByteReg = byte(addr)
-		m.InWriteSeq = true
-		m.AddrCycles = 0
-	} else if addr == 0x1ff8 {
-		m.loadCtrlReg(m.ByteReg)
-		m.InWriteSeq = false // ?
-	} else if addr == 0x1ff9 {
-		emuErr("0x1ff9 - audio reg read not impld")
-	}
-
-	return m.RAM[bank*2048+addr-offset]
-}
-func (m *mapper66) write(mem *mem, addr uint16, val byte) {
-	m.read(mem, addr)
-}
-func (m *mapper66) getMapperNum() uint16 { return 0x66 }
-func (m *mapper66) getBankNum() uint16   { return uint16(m.BankCtrl) }
-func (m *mapper66) runCycle(emu *emuState) {
-	if m.InWriteSeq {
-		// catch reads we can't see...
-		addr := emu.Mem.lastReadAddr & 0x1fff
-		if addr < 0x1000 {
-			if addr != m.LastAddr {
-				m.AddrCycles++
-			}
-		}
-		m.LastAddr = addr
-	}
-}
-func (m *mapper66) loadCtrlReg(reg byte) {
-	m.BankCtrl = reg >> 2 & 7
-	m.WriteEnable = reg&2 != 0
-	m.ROMEnable = reg&1 == 0
-}
-func (m *mapper66) init(emu *emuState) {
-	copy(m.RAM[:], emu.Mem.rom[:6*1024])
-
-	m.BankCtrl = 2 // temp for dummy step
-	emu.CPU.Step() // allows for doReset()
-
-	emu.CPU.PC = uint16(emu.Mem.rom[8*1024+1])<<8 | uint16(emu.Mem.rom[8*1024])
-	ctrlReg := emu.Mem.rom[8*1024+2]
-	emu.Mem.RAM = [128]byte{}
-	emu.Mem.RAM[0] = ctrlReg
-	m.loadCtrlReg(ctrlReg)
-}
@@ -0,0 +1,197 @@
+package vcsgo
+
+import "fmt"
+
+// The Starpath Supercharger (AR) sits in the cart slot and provides
+// 6K of RAM and a 2K BIOS ROM that loads games off of cassette tape.
+//
+// ROM images are one or more 8448 byte loads: 8K of page data followed
+// by a 256 byte header. We don't have (or want) the real BIOS, so a
+// tiny stand-in is built below. It asks the mapper for a load by
+// number, the mapper copies that load into RAM the way the tape
+// routine would, and the BIOS then sets up the banks and jumps in.
+
+const arLoadSize = 8*1024 + 256
+
+// BIOS offsets, mapped in at 0x1800 (0xf800)
+const (
+	arBIOSMultiloadEntry = 0x000
+	arBIOSResetEntry     = 0x00a
+	arBIOSLoadHotspot    = 0x050
+	arBIOSZeroPageStub   = 0x060
+)
+
+var arBIOS = makeARBIOS()
+
+func makeARBIOS() [2048]byte {
+	var bios [2048]byte
+	for i := range bios {
+		bios[i] = 0xff
+	}
+	put := func(offset int, code ...byte) {
+		copy(bios[offset:], code)
+	}
+
+	// multiload games put the load number they want
+	// in 0xfa and jump here with the BIOS banked in
+	put(arBIOSMultiloadEntry,
+		0xa5, 0xfa, // LDA $FA
+		0x85, 0x80, // STA $80
+		0x4c, 0x50, 0xf8, // JMP $F850
+	)
+
+	// mapper init leaves the first load's number in 0xfa
+	put(arBIOSResetEntry,
+		0x78,       // SEI
+		0xd8,       // CLD
+		0xa2, 0xff, // LDX #$FF
+		0x9a,             // TXS
+		0x4c, 0x00, 0xf8, // JMP $F800
+	)
+
+	// fetching the first opcode here triggers the load,
+	// which leaves the bank config in 0x80 and the start
+	// addr in 0xfe/0xff. The final bank switch has to be
+	// done from zero page, so copy a stub there and run it.
+	put(arBIOSLoadHotspot,
+		0xa2, 0x0a, // LDX #10
+		0xbd, 0x60, 0xf8, // LDA $F860,X
+		0x95, 0xf0, // STA $F0,X
+		0xca,       // DEX
+		0x10, 0xf8, // BPL $F852
+		0x4c, 0xf0, 0x00, // JMP $00F0
+	)
+	put(arBIOSZeroPageStub,
+		0xa6, 0x80, // LDX $80
+		0xdd, 0x00, 0xf0, // CMP $F000,X (data hold = bank config)
+		0xad, 0xf8, 0xff, // LDA $FFF8 (latch bank config)
+		0x6c, 0xfe, 0x00, // JMP ($00FE)
+	)
+
+	// NMI, RESET, IRQ
+	put(0x7fa, 0x0a, 0xf8, 0x0a, 0xf8, 0x0a, 0xf8)
+
+	return bios
+}
+
+type mapper66 struct {
+	BankCtrl    byte
+	WriteEnable bool
+	ROMEnable   bool
+
+	RAM [6 * 1024]byte
+
+	DataHold         byte
+	WritePending     bool
+	WriteStartAccess uint64
+}
+
+// bank 3 is the BIOS ROM
+var mapper66BankTable = [2][8]uint16{
+	{2, 0, 2, 0, 2, 1, 2, 1},
+	{3, 3, 0, 2, 3, 3, 1, 2},
+}
+
+func (m *mapper66) slotBank(addr uint16) uint16 {
+	return mapper66BankTable[(addr>>11)&1][m.BankCtrl]
+}
+
+func (m *mapper66) read(mem *mem, addr uint16) byte {
+	addr &= 0x1fff
+	if addr == 0x1800+arBIOSLoadHotspot && m.slotBank(addr) == 3 {
+		m.loadIntoRAM(mem, mem.RAM[0])
+	} else {
+		m.access(mem, addr)
+	}
+	if bank := m.slotBank(addr); bank != 3 {
+		return m.RAM[bank*2048+(addr&0x7ff)]
+	}
+	return arBIOS[addr&0x7ff]
+}
+
+// Writes to RAM are done by touching 0x1000-0x10ff (the low
+// byte of the addr goes into the data hold register), then
+// touching the target addr exactly five distinct bus accesses
+// later. The data bus value from the CPU is never used.
+func (m *mapper66) access(mem *mem, addr uint16) {
+	if m.WritePending && mem.DistinctAccesses > m.WriteStartAccess+5 {
+		m.WritePending = false
+	}
+
+	if addr&0x0f00 == 0 && (!m.WriteEnable || !m.WritePending) {
+		m.DataHold = byte(addr)
+		m.WriteStartAccess = mem.DistinctAccesses
+		m.WritePending = true
+	} else if addr == 0x1ff8 {
+		m.WritePending = false
+		m.loadCtrlReg(m.DataHold)
+	} else if m.WriteEnable && m.WritePending && mem.DistinctAccesses == m.WriteStartAccess+5 {
+		if bank := m.slotBank(addr); bank != 3 {
+			m.RAM[bank*2048+(addr&0x7ff)] = m.DataHold
+		}
+		m.WritePending = false
+	}
+}
+
+func (m *mapper66) write(mem *mem, addr uint16, val byte) {
+	m.read(mem, addr)
+}
+func (m *mapper66) getMapperNum() uint16   { return 0x66 }
+func (m *mapper66) getBankNum() uint16     { return uint16(m.BankCtrl) }
+func (m *mapper66) runCycle(emu *emuState) {}
+
+func (m *mapper66) loadCtrlReg(reg byte) {
+	m.BankCtrl = reg >> 2 & 7
+	m.WriteEnable = reg&2 != 0
+	m.ROMEnable = reg&1 == 0
+}
+
+func arChecksum(bytes []byte) byte {
+	sum := byte(0)
+	for _, b := range bytes {
+		sum += b
+	}
+	return sum
+}
+
+// loadIntoRAM does what the BIOS would do after reading a
+// load off of tape, leaving the results in 2600 RAM for the
+// rest of the fake BIOS to use.
+func (m *mapper66) loadIntoRAM(mem *mem, loadNum byte) {
+	for start := 0; start+arLoadSize <= len(mem.rom); start += arLoadSize {
+		load := mem.rom[start : start+arLoadSize]
+		header := load[8192:]
+		if header[5] != loadNum {
+			continue
+		}
+		if arChecksum(header[:8]) != 0x55 {
+			mem.log.warnOnce(LogMapper, "supercharger: bad header checksum")
+		}
+		numPages := int(header[3])
+		if numPages > 32 {
+			numPages = 32
+		}
+		for i := 0; i < numPages; i++ {
+			page := load[i*256 : (i+1)*256]
+			pageInfo := header[16+i]
+			if arChecksum(page)+pageInfo+header[64+i] != 0x55 {
+				mem.log.warnOnce(LogMapper, "supercharger: bad page checksum")
+			}
+			bank := uint16(pageInfo & 3)
+			pageNum := uint16(pageInfo>>2) & 7
+			if bank < 3 {
+				copy(m.RAM[bank*2048+pageNum*256:], page)
+			}
+		}
+		mem.RAM[0xfe-0x80] = header[0]
+		mem.RAM[0xff-0x80] = header[1]
+		mem.RAM[0x80-0x80] = header[2]
+		return
+	}
+	mem.log.warnOnce(LogMapper, fmt.Sprintf("supercharger: load 0x%02x not found", loadNum))
+}
+
+func (m *mapper66) init(emu *emuState) {
+	m.loadCtrlReg(0) // BIOS in the upper slot for the reset vector
+	emu.Mem.RAM[0xfa-0x80] = emu.Mem.rom[arLoadSize-256+5]
+}
@@ -0,0 +1,254 @@
+package vcsgo
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Supercharger tapes encode each bit as a single cycle of a
+// square-ish wave, a short cycle for 0 and a long one for 1,
+// MSB first. Each load starts with a lead-in tone of 0x55
+// bytes ended by a 0x54 sync byte, followed by the 8 byte
+// load header (start addr, bank config, page count, checksum,
+// load number, progress bar speed), then for each page its
+// bank/page byte, its checksum byte, and the 256 page bytes.
+//
+// Nothing about the timing is fixed across recordings, so
+// the 0/1 threshold is taken from the lead-in tone, which is
+// half short cycles and half long ones.
+
+const arTapeLeadInCycles = 64
+
+func isWAV(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE"
+}
+
+// readWAVSamples returns the first channel of a PCM wav as
+// signed samples.
+func readWAVSamples(wav []byte) ([]int, error) {
+	if !isWAV(wav) {
+		return nil, fmt.Errorf("not a wav file")
+	}
+	var channels, bitsPerSample int
+	fmtFound := false
+	for pos := 12; pos+8 <= len(wav); {
+		chunkID := string(wav[pos : pos+4])
+		chunkLen := int(binary.LittleEndian.Uint32(wav[pos+4:]))
+		pos += 8
+		if chunkLen > len(wav)-pos {
+			chunkLen = len(wav) - pos
+		}
+		chunk := wav[pos : pos+chunkLen]
+		pos += chunkLen + chunkLen&1
+
+		switch chunkID {
+		case "fmt ":
+			if len(chunk) < 16 {
+				return nil, fmt.Errorf("wav fmt chunk too short")
+			}
+			if format := binary.LittleEndian.Uint16(chunk); format != 1 {
+				return nil, fmt.Errorf("unsupported wav format %d, only PCM is supported", format)
+			}
+			channels = int(binary.LittleEndian.Uint16(chunk[2:]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(chunk[14:]))
+			if channels < 1 || (bitsPerSample != 8 && bitsPerSample != 16) {
+				return nil, fmt.Errorf("unsupported wav layout: %d channels, %d bits", channels, bitsPerSample)
+			}
+			fmtFound = true
+		case "data":
+			if !fmtFound {
+				return nil, fmt.Errorf("wav data chunk before fmt chunk")
+			}
+			frameSize := channels * bitsPerSample / 8
+			samples := make([]int, len(chunk)/frameSize)
+			for i := range samples {
+				frame := chunk[i*frameSize:]
+				if bitsPerSample == 8 {
+					samples[i] = int(frame[0]) - 128
+				} else {
+					samples[i] = int(int16(binary.LittleEndian.Uint16(frame)))
+				}
+			}
+			return samples, nil
+		}
+	}
+	return nil, fmt.Errorf("no data chunk found in wav")
+}
+
+// tapeCycles returns the length in samples of each full cycle
+// in the signal, measured between rising edges.
+func tapeCycles(samples []int) []int {
+	if len(samples) == 0 {
+		return nil
+	}
+	min, max, sum := samples[0], samples[0], 0
+	for _, s := range samples {
+		if s < min {
+			min = s
+		}
+		if s > max {
+			max = s
+		}
+		sum += s
+	}
+	center := sum / len(samples)
+	hysteresis := (max - min) / 8
+
+	var cycles []int
+	high := false
+	rise, fall := -1, -1
+	endCycle := func(next int) {
+		if rise < 0 {
+			return
+		}
+		length := next - rise
+		// a cycle followed by a gap only has its first half to go on
+		if highLen := fall - rise; highLen > 0 && length > 3*highLen {
+			length = 2 * highLen
+		}
+		cycles = append(cycles, length)
+	}
+	for i, s := range samples {
+		if !high && s > center+hysteresis {
+			high = true
+			endCycle(i)
+			rise = i
+		} else if high && s < center-hysteresis {
+			high = false
+			fall = i
+		}
+	}
+	endCycle(len(samples))
+	return cycles
+}
+
+type arTape struct {
+	cycles    []int
+	pos       int
+	threshold float64
+}
+
+func (t *arTape) readBit() (byte, error) {
+	if t.pos >= len(t.cycles) {
+		return 0, fmt.Errorf("tape ended mid-load")
+	}
+	c := float64(t.cycles[t.pos])
+	t.pos++
+	if c > 2*t.threshold {
+		return 0, fmt.Errorf("lost signal at cycle %d", t.pos)
+	}
+	if c > t.threshold {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (t *arTape) readBytes(buf []byte) error {
+	for i := range buf {
+		var val byte
+		for j := 0; j < 8; j++ {
+			bit, err := t.readBit()
+			if err != nil {
+				return err
+			}
+			val = val<<1 | bit
+		}
+		buf[i] = val
+	}
+	return nil
+}
+
+func (t *arTape) isLeadIn(window []int) bool {
+	sum := 0
+	for _, c := range window {
+		sum += c
+	}
+	threshold := float64(sum) / float64(len(window))
+	for i, c := range window {
+		if diff := float64(c) - threshold; diff < threshold*0.1 && diff > -threshold*0.1 {
+			return false
+		}
+		if i > 0 && (float64(c) > threshold) == (float64(window[i-1]) > threshold) {
+			return false
+		}
+	}
+	t.threshold = threshold
+	return true
+}
+
+// findLoadStart leaves pos at the first bit after the next
+// lead-in and sync byte, returning false if there are none.
+func (t *arTape) findLoadStart() bool {
+	for t.pos+arTapeLeadInCycles <= len(t.cycles) {
+		if !t.isLeadIn(t.cycles[t.pos : t.pos+arTapeLeadInCycles]) {
+			t.pos++
+			continue
+		}
+		// the sync byte ends in the first pair of 0s
+		lastBit := byte(1)
+		for {
+			bit, err := t.readBit()
+			if err != nil {
+				break
+			}
+			if bit == 0 && lastBit == 0 {
+				return true
+			}
+			lastBit = bit
+		}
+	}
+	return false
+}
+
+func (t *arTape) readLoad() ([]byte, error) {
+	load := make([]byte, arLoadSize)
+	header := load[8192:]
+	if err := t.readBytes(header[:8]); err != nil {
+		return nil, err
+	}
+	if arChecksum(header[:8]) != 0x55 {
+		return nil, fmt.Errorf("bad header checksum")
+	}
+	numPages := int(header[3])
+	if numPages > 32 {
+		return nil, fmt.Errorf("bad page count %d", numPages)
+	}
+	for i := 0; i < numPages; i++ {
+		var pageHeader [2]byte
+		if err := t.readBytes(pageHeader[:]); err != nil {
+			return nil, err
+		}
+		page := load[i*256 : (i+1)*256]
+		if err := t.readBytes(page); err != nil {
+			return nil, err
+		}
+		if arChecksum(page)+pageHeader[0]+pageHeader[1] != 0x55 {
+			return nil, fmt.Errorf("bad checksum on page %d", i)
+		}
+		header[16+i] = pageHeader[0]
+		header[64+i] = pageHeader[1]
+	}
+	return load, nil
+}
+
+// decodeARTape turns a recording of a supercharger tape into
+// the N * 8448 byte image format that mapper66 loads from.
+func decodeARTape(wav []byte) ([]byte, error) {
+	samples, err := readWAVSamples(wav)
+	if err != nil {
+		return nil, err
+	}
+	tape := arTape{cycles: tapeCycles(samples)}
+	var image []byte
+	for tape.findLoadStart() {
+		load, err := tape.readLoad()
+		if err != nil {
+			return nil, fmt.Errorf("supercharger tape, load #%d: %v", len(image)/arLoadSize, err)
+		}
+		image = append(image, load...)
+	}
+	if len(image) == 0 {
+		return nil, fmt.Errorf("no supercharger loads found on tape")
+	}
+	return image, nil
+}
@@ -0,0 +1,172 @@
+package vcsgo
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// testARLoad makes a full 32 page load of random bytes, with a
+// header and page checksums that add up.
+func testARLoad(num byte, seed int64) []byte {
+	rng := rand.New(rand.NewSource(seed))
+	load := make([]byte, arLoadSize)
+	rng.Read(load[:8192])
+	h := load[8192:]
+	h[0], h[1] = 0x00, 0xf8 // start addr
+	h[2] = 0x1d             // bank config
+	h[3] = 32               // page count
+	h[5] = num
+	h[6], h[7] = 0x4c, 0x00 // progress bar speed
+	h[4] = 0x55 - arChecksum(h[:8])
+	for i := 0; i < 32; i++ {
+		h[16+i] = byte(i)
+		h[64+i] = 0x55 - arChecksum(load[i*256:(i+1)*256]) - h[16+i]
+	}
+	return load
+}
+
+// tapeBytes lists the bytes a load is recorded as, after the
+// lead-in and sync byte
+func tapeBytes(load []byte) []byte {
+	h := load[8192:]
+	out := append([]byte{}, h[:8]...)
+	for i := 0; i < int(h[3]); i++ {
+		out = append(out, h[16+i], h[64+i])
+		out = append(out, load[i*256:(i+1)*256]...)
+	}
+	return out
+}
+
+// synthTape records loads the way a supercharger tape sounds:
+// one sine cycle per bit, 0s short and 1s long, with a bit of
+// silence around each load. The timing doesn't line up with
+// the sample rate, so cycle lengths jitter like a real dump.
+func synthTape(loads [][]byte, rate, bits int, dcOffset float64) []byte {
+	const zeroLen, oneLen = 270e-6, 450e-6 // seconds
+	var samples []float64
+	t := 0.0
+	silence := func(secs float64) {
+		for end := t + secs; t < end; t += 1 / float64(rate) {
+			samples = append(samples, dcOffset)
+		}
+	}
+	cycleStart := 0.0
+	cycle := func(length float64) {
+		for ; t < cycleStart+length; t += 1 / float64(rate) {
+			phase := (t - cycleStart) / length
+			samples = append(samples, dcOffset+0.5*math.Sin(2*math.Pi*phase))
+		}
+		cycleStart += length
+	}
+	writeByte := func(b byte) {
+		for i := 7; i >= 0; i-- {
+			if b>>uint(i)&1 == 1 {
+				cycle(oneLen)
+			} else {
+				cycle(zeroLen)
+			}
+		}
+	}
+	for _, load := range loads {
+		silence(0.05)
+		cycleStart = t
+		for i := 0; i < 200; i++ {
+			writeByte(0x55)
+		}
+		writeByte(0x54)
+		for _, b := range tapeBytes(load) {
+			writeByte(b)
+		}
+		silence(0.05)
+	}
+
+	frameSize := bits / 8
+	data := make([]byte, len(samples)*frameSize)
+	for i, s := range samples {
+		if bits == 8 {
+			data[i] = byte(128 + int(s*127))
+		} else {
+			binary.LittleEndian.PutUint16(data[i*2:], uint16(int16(s*32767)))
+		}
+	}
+	le16 := func(b []byte, v uint16) []byte { return append(b, byte(v), byte(v>>8)) }
+	le32 := func(b []byte, v uint32) []byte { return le16(le16(b, uint16(v)), uint16(v>>16)) }
+	wav := []byte("RIFF\x00\x00\x00\x00WAVEfmt ")
+	wav = le32(wav, 16)
+	wav = le16(wav, 1) // PCM
+	wav = le16(wav, 1) // mono
+	wav = le32(wav, uint32(rate))
+	wav = le32(wav, uint32(rate*frameSize))
+	wav = le16(wav, uint16(frameSize))
+	wav = le16(wav, uint16(bits))
+	wav = append(wav, "data"...)
+	wav = le32(wav, uint32(len(data)))
+	wav = append(wav, data...)
+	binary.LittleEndian.PutUint32(wav[4:], uint32(len(wav)-8))
+	return wav
+}
+
+func TestDecodeARTape(t *testing.T) {
+	load := testARLoad(0, 1)
+	for _, rate := range []int{22050, 44100, 48000} {
+		for _, bits := range []int{8, 16} {
+			for _, dc := range []float64{0, 0.3} {
+				image, err := decodeARTape(synthTape([][]byte{load}, rate, bits, dc))
+				if err != nil {
+					t.Errorf("%v Hz, %v bit, dc %v: %v", rate, bits, dc, err)
+					continue
+				}
+				if string(image) != string(load) {
+					t.Errorf("%v Hz, %v bit, dc %v: decoded load doesn't match", rate, bits, dc)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeARTapeMultiLoad(t *testing.T) {
+	loads := [][]byte{testARLoad(0, 1), testARLoad(1, 2), testARLoad(2, 3)}
+	image, err := decodeARTape(synthTape(loads, 44100, 16, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(image) != string(append(append(append([]byte{}, loads[0]...), loads[1]...), loads[2]...)) {
+		t.Errorf("decoded %d bytes, don't match the three loads", len(image))
+	}
+}
+
+func TestDecodeARTapeErrors(t *testing.T) {
+	load := testARLoad(0, 1)
+	wav := synthTape([][]byte{load}, 44100, 16, 0)
+
+	badHeader := append([]byte{}, load...)
+	badHeader[8192+2] ^= 0x01 // bank config, checksum now off
+
+	badPage := append([]byte{}, load...)
+	badPage[5*256+17] ^= 0x80
+
+	notPCM := append([]byte{}, wav...)
+	binary.LittleEndian.PutUint16(notPCM[20:], 3) // float
+
+	for _, c := range []struct {
+		name string
+		wav  []byte
+		want string
+	}{
+		{"truncated", wav[:len(wav)/2], "load #0"},
+		{"not a wav", append([]byte("RIFX"), wav[4:]...), "not a wav file"},
+		{"not pcm", notPCM, "unsupported wav format 3"},
+		{"no data", wav[:36], "no data chunk"},
+		{"silence", synthTape(nil, 44100, 16, 0), "no supercharger loads"},
+		{"bad load header", synthTape([][]byte{badHeader}, 44100, 16, 0), "bad header checksum"},
+		{"bad page", synthTape([][]byte{badPage}, 44100, 16, 0), "bad checksum on page 5"},
+	} {
+		_, err := decodeARTape(c.wav)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%v: got %v, want an error containing %q", c.name, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package vcsgo
+
+import "bytes"
+
+// Mappers that bankswitch on accesses below 0x1000, usually
+// to mirrors of TIA addrs that games otherwise never touch.
+
+// UA (Universal Attractions): two 4K banks, selected by
+// accesses to 0x220 and 0x240.
+type mapperUA struct {
+	BankNum uint16
+}
+
+func isUA(rom []byte) bool {
+	return len(rom) == 8*1024 && containsAny(rom,
+		[]byte{0x8d, 0x40, 0x02}, // STA $240
+		[]byte{0xad, 0x40, 0x02}, // LDA $240
+		[]byte{0xbd, 0x1f, 0x02}, // LDA $21F,X
+		[]byte{0x2c, 0xc0, 0x02}, // BIT $2C0
+		[]byte{0x8d, 0xc0, 0x02}, // STA $2C0
+		[]byte{0xad, 0xc0, 0x02}, // LDA $2C0
+	)
+}
+
+func (m *mapperUA) read(mem *mem, addr uint16) byte {
+	return mem.rom[int(m.BankNum)*4096+int(addr&0xfff)]
+}
+func (m *mapperUA) write(mem *mem, addr uint16, val byte) {}
+func (m *mapperUA) watchBus(mem *mem, addr uint16, val byte) {
+	switch addr & 0x1260 {
+	case 0x0220:
+		m.BankNum = 0
+	case 0x0240:
+		m.BankNum = 1
+	}
+}
+func (m *mapperUA) getMapperNum() uint16   { return 0x220 }
+func (m *mapperUA) getBankNum() uint16     { return m.BankNum }
+func (m *mapperUA) runCycle(emu *emuState) {}
+func (m *mapperUA) init(emu *emuState)     {}
+
+// 0840 (EconoBanking): two 4K banks, selected by accesses
+// to 0x800 and 0x840.
+type mapper0840 struct {
+	BankNum uint16
+}
+
+func is0840(rom []byte) bool {
+	return len(rom) == 8*1024 && containsAny(rom,
+		[]byte{0xad, 0x00, 0x08},       // LDA $0800
+		[]byte{0xad, 0x40, 0x08},       // LDA $0840
+		[]byte{0x2c, 0x00, 0x08},       // BIT $0800
+		[]byte{0x0c, 0x00, 0x08, 0x4c}, // NOP $0800; JMP
+		[]byte{0x0c, 0xff, 0x0f, 0x4c}, // NOP $0FFF; JMP
+	)
+}
+
+func (m *mapper0840) read(mem *mem, addr uint16) byte {
+	return mem.rom[int(m.BankNum)*4096+int(addr&0xfff)]
+}
+func (m *mapper0840) write(mem *mem, addr uint16, val byte) {}
+func (m *mapper0840) watchBus(mem *mem, addr uint16, val byte) {
+	switch addr & 0x1840 {
+	case 0x0800:
+		m.BankNum = 0
+	case 0x0840:
+		m.BankNum = 1
+	}
+}
+func (m *mapper0840) getMapperNum() uint16   { return 0x840 }
+func (m *mapper0840) getBankNum() uint16     { return m.BankNum }
+func (m *mapper0840) runCycle(emu *emuState) {}
+func (m *mapper0840) init(emu *emuState)     {}
+
+// SB (Superbanking): 128K or 256K of 4K banks, selected by the
+// low bits of an access to 0x800-0xfff.
+type mapperSB struct {
+	BankNum uint16
+}
+
+func isSB(rom []byte) bool {
+	return (len(rom) == 128*1024 || len(rom) == 256*1024) && containsAny(rom,
+		[]byte{0xbd, 0x00, 0x08}, // LDA $0800,X
+		[]byte{0xad, 0x00, 0x08}, // LDA $0800
+	)
+}
+
+func (m *mapperSB) read(mem *mem, addr uint16) byte {
+	return mem.rom[int(m.BankNum)*4096+int(addr&0xfff)]
+}
+func (m *mapperSB) write(mem *mem, addr uint16, val byte) {}
+func (m *mapperSB) watchBus(mem *mem, addr uint16, val byte) {
+	if addr&0x1800 == 0x0800 {
+		m.BankNum = addr & uint16(len(mem.rom)/4096-1)
+	}
+}
+func (m *mapperSB) getMapperNum() uint16   { return 0x5b }
+func (m *mapperSB) getBankNum() uint16     { return m.BankNum }
+func (m *mapperSB) runCycle(emu *emuState) {}
+
+// starts in the last bank
+func (m *mapperSB) init(emu *emuState) {
+	m.BankNum = uint16(len(emu.Mem.rom)/4096 - 1)
+}
+
+// X07: 64K of 4K banks. An access to 0x80d with the bank number
+// in bits 4-7 selects any bank, and from banks 14 or 15, any TIA
+// access picks between them with bit 6.
+type mapperX07 struct {
+	BankNum uint16
+}
+
+func isX07(rom []byte) bool {
+	return len(rom) == 64*1024 && containsAny(rom,
+		[]byte{0xad, 0x0d, 0x08}, // LDA $080D
+		[]byte{0xad, 0x1d, 0x08}, // LDA $081D
+		[]byte{0xad, 0x2d, 0x08}, // LDA $082D
+		[]byte{0x0c, 0x0d, 0x08}, // NOP $080D
+		[]byte{0x0c, 0x1d, 0x08}, // NOP $081D
+		[]byte{0x0c, 0x2d, 0x08}, // NOP $082D
+	)
+}
+
+func (m *mapperX07) read(mem *mem, addr uint16) byte {
+	return mem.rom[int(m.BankNum)*4096+int(addr&0xfff)]
+}
+func (m *mapperX07) write(mem *mem, addr uint16, val byte) {}
+func (m *mapperX07) watchBus(mem *mem, addr uint16, val byte) {
+	if addr&0x180f == 0x080d {
+		m.BankNum = (addr & 0xf0) >> 4
+	} else if addr&0x1880 == 0 && m.BankNum&0xe == 0xe {
+		m.BankNum = (addr&0x40)>>6 | 0xe
+	}
+}
+func (m *mapperX07) getMapperNum() uint16   { return 0x07 }
+func (m *mapperX07) getBankNum() uint16     { return m.BankNum }
+func (m *mapperX07) runCycle(emu *emuState) {}
+func (m *mapperX07) init(emu *emuState)     {}
+
+// 4A50 (Supercat): up to 128K of ROM and 32K of RAM, seen
+// through a 2K slice at 0x1000, a 1.5K slice at 0x1800, a 256
+// byte slice at 0x1e00, and a fixed last page at 0x1f00.
+//
+// Slices are switched by accesses to a whole pile of hotspots,
+// but only when the last byte on the bus was 0x60-0x7f, which
+// in practice means an absolute addr like $6C12 (a mirror of
+// $0C12), so normal code won't hit them by accident. Smaller
+// images are mirrored to fill 128K.
+type mapper4A50 struct {
+	RAM [32 * 1024]byte
+
+	SliceLow, SliceMiddle, SliceHigh int
+	ROMLow, ROMMiddle, ROMHigh       bool
+
+	LastData byte
+	LastAddr uint16
+}
+
+// the NMI vector is $4A50
+func is4A50(rom []byte) bool {
+	n := len(rom)
+	return (n == 32*1024 || n == 64*1024 || n == 128*1024) &&
+		rom[n-6] == 0x50 && rom[n-5] == 0x4a
+}
+
+func (m *mapper4A50) romByte(mem *mem, offset int) byte {
+	return mem.rom[offset%len(mem.rom)]
+}
+
+func (m *mapper4A50) read(mem *mem, addr uint16) byte {
+	addr &= 0x1fff
+	var val byte
+	switch {
+	case addr < 0x1800:
+		if m.ROMLow {
+			val = m.romByte(mem, m.SliceLow+int(addr&0x7ff))
+		} else {
+			val = m.RAM[(m.SliceLow+int(addr&0x7ff))%len(m.RAM)]
+		}
+	case addr < 0x1e00:
+		if m.ROMMiddle {
+			val = m.romByte(mem, m.SliceMiddle+int(addr&0x7ff)+0x10000)
+		} else {
+			val = m.RAM[(m.SliceMiddle+int(addr&0x7ff))%len(m.RAM)]
+		}
+	case addr < 0x1f00:
+		if m.ROMHigh {
+			val = m.romByte(mem, m.SliceHigh+int(addr&0xff)+0x10000)
+		} else {
+			val = m.RAM[(m.SliceHigh+int(addr&0xff))%len(m.RAM)]
+		}
+	default:
+		val = m.romByte(mem, 0x1ff00+int(addr&0xff))
+		m.checkHighPageSwitch(addr)
+	}
+	m.LastData, m.LastAddr = val, addr
+	return val
+}
+
+func (m *mapper4A50) write(mem *mem, addr uint16, val byte) {
+	addr &= 0x1fff
+	switch {
+	case addr < 0x1800:
+		if !m.ROMLow {
+			m.RAM[(m.SliceLow+int(addr&0x7ff))%len(m.RAM)] = val
+		}
+	case addr < 0x1e00:
+		if !m.ROMMiddle {
+			m.RAM[(m.SliceMiddle+int(addr&0x7ff))%len(m.RAM)] = val
+		}
+	case addr < 0x1f00:
+		if !m.ROMHigh {
+			m.RAM[(m.SliceHigh+int(addr&0xff))%len(m.RAM)] = val
+		}
+	default:
+		m.checkHighPageSwitch(addr)
+	}
+	m.LastData, m.LastAddr = val, addr
+}
+
+func (m *mapper4A50) hotspotsArmed() bool {
+	return m.LastData&0xe0 == 0x60 && (m.LastAddr >= 0x1000 || m.LastAddr < 0x200)
+}
+
+// accesses to the last page can move the 0x1e00 slice around
+// within its current 4K
+func (m *mapper4A50) checkHighPageSwitch(addr uint16) {
+	if m.hotspotsArmed() {
+		m.SliceHigh = m.SliceHigh&0xf0ff | int(addr&0x8)<<8 | int(addr&0x70)<<4
+	}
+}
+
+func (m *mapper4A50) watchBus(mem *mem, addr uint16, val byte) {
+	addr &= 0x1fff
+	if m.hotspotsArmed() {
+		switch {
+		case addr&0xf00 == 0xc00:
+			m.ROMHigh, m.SliceHigh = true, int(addr&0xff)<<8
+		case addr&0xf00 == 0xd00:
+			m.ROMHigh, m.SliceHigh = false, int(addr&0x7f)<<8
+		case addr&0xf40 == 0xe00:
+			m.ROMLow, m.SliceLow = true, int(addr&0x1f)<<11
+		case addr&0xf40 == 0xe40:
+			m.ROMLow, m.SliceLow = false, int(addr&0xf)<<11
+		case addr&0xf40 == 0xf00:
+			m.ROMMiddle, m.SliceMiddle = true, int(addr&0x1f)<<11
+		case addr&0xf50 == 0xf40:
+			m.ROMMiddle, m.SliceMiddle = false, int(addr&0xf)<<11
+		}
+
+		// zero page hotspots take the slice from the data
+		switch {
+		case addr&0xf75 == 0x74:
+			m.ROMHigh, m.SliceHigh = true, int(val)<<8
+		case addr&0xf75 == 0x75:
+			m.ROMHigh, m.SliceHigh = false, int(val&0x7f)<<8
+		case addr&0xf7c == 0x78:
+			switch val & 0xf0 {
+			case 0x00:
+				m.ROMLow, m.SliceLow = true, int(val&0xf)<<11
+			case 0x40:
+				m.ROMLow, m.SliceLow = false, int(val&0xf)<<11
+			case 0x90:
+				m.ROMMiddle, m.SliceMiddle = true, int(val&0xf|0x10)<<11
+			case 0xc0:
+				m.ROMMiddle, m.SliceMiddle = false, int(val&0xf)<<11
+			}
+		}
+	}
+	m.LastData, m.LastAddr = val, addr
+}
+
+func (m *mapper4A50) getMapperNum() uint16 { return 0x4a50 }
+func (m *mapper4A50) getBankNum() uint16 {
+	return uint16(m.SliceLow>>11)<<8 | uint16(m.SliceMiddle>>11)
+}
+func (m *mapper4A50) runCycle(emu *emuState) {}
+func (m *mapper4A50) init(emu *emuState) {
+	m.ROMLow, m.ROMMiddle, m.ROMHigh = true, true, true
+	m.LastData, m.LastAddr = 0xff, 0xffff
+}
+
+func containsAny(rom []byte, patterns ...[]byte) bool {
+	for _, p := range patterns {
+		if bytes.Contains(rom, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,348 @@
+package vcsgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// CDF (and its later versions CDFJ and CDFJ+) is the successor
+// to DPC+ on the Harmony/Melody boards. The image is a 2K ARM
+// driver followed by the 4K banks of 6507 code, and the ARM's
+// RAM holds a copy of the driver followed by display data.
+//
+// Unlike DPC+, the 6507 doesn't read registers at all. With fast
+// fetch on, the operand of every LDA # is instead used to pick a
+// data stream (or the audio amplitude) to read from. Each data
+// stream is a 32-bit fixed point pointer and increment kept in
+// the driver's RAM, where the game's C code can set them up. A
+// JMP $0000 (or $0001 on CDFJ) reads its target from a stream.
+//
+// The driver's job is done natively here, and the C code is run
+// on the thumb interpreter. Calls the C code makes back into the
+// driver (for music) are caught by driverCall.
+
+const (
+	cdfDriverSize    = 0x0800
+	cdfBankStart     = 0x0800
+	cdfDisplayStart  = 0x0800
+	cdfCodeEntry     = 0x0808
+	cdfCodeReturn    = 0x0800
+	cdfRAMSize       = 8 * 1024
+	cdfJPlusRAMSize  = 32 * 1024
+	cdfCommStream    = 0x20
+	cdfJumpStream    = 0x21
+	cdfDefaultWaveSz = 27
+)
+
+const (
+	cdfVersion0 = iota
+	cdfVersion1
+	cdfVersionJ
+	cdfVersionJPlus
+)
+
+// per-version layout of the driver's RAM
+type cdfLayout struct {
+	amplitudeStream byte
+	jumpStreamMask  byte
+	streamBase      int
+	incrementBase   int
+	waveformBase    int
+
+	// CDFJ+ streams have 16 bit addrs, the others 12 bit
+	addrShift uint
+	incShift  uint
+
+	// digital audio samples are addressed by the top bits of
+	// the first music counter, which are fewer on CDFJ+ since
+	// its samples can be anywhere in its bigger ROM.
+	sampleShift uint
+
+	// where the C code calls the driver's music routines
+	// (set note, reset wave, get wave pointer, set wave size),
+	// which moved as the driver was rebuilt
+	driverCalls [4]uint32
+}
+
+var cdfLayouts = [...]cdfLayout{
+	cdfVersion0:     {0x22, 0xff, 0x06e0, 0x0768, 0x07f0, 20, 12, 21, [4]uint32{0x080c, 0x0810, 0x0814, 0x0818}},
+	cdfVersion1:     {0x22, 0xff, 0x00a0, 0x0128, 0x01b0, 20, 12, 21, [4]uint32{0x0750, 0x0754, 0x0758, 0x075c}},
+	cdfVersionJ:     {0x23, 0xfe, 0x0098, 0x0124, 0x01b0, 20, 12, 21, [4]uint32{0x0750, 0x0754, 0x0758, 0x075c}},
+	cdfVersionJPlus: {0x23, 0xfe, 0x0098, 0x0124, 0x01b0, 16, 8, 13, [4]uint32{0x0760, 0x0764, 0x0768, 0x076c}},
+}
+
+// the driver contains its name three times, followed by
+// the version byte.
+func isCDF(rom []byte) bool {
+	return bytes.Contains(rom, []byte("PLUSCDFJ")) || bytes.Count(rom, []byte("CDF")) >= 3
+}
+
+func cdfVersion(rom []byte) int {
+	if bytes.Contains(rom, []byte("PLUSCDFJ")) {
+		return cdfVersionJPlus
+	}
+	for i := 0; i+4 <= cdfDriverSize && i+4 <= len(rom); i++ {
+		if string(rom[i:i+3]) == "CDF" {
+			switch rom[i+3] {
+			case 0:
+				return cdfVersion0
+			case 'J':
+				return cdfVersionJ
+			default:
+				return cdfVersion1
+			}
+		}
+	}
+	return cdfVersion1
+}
+
+type cdf struct {
+	Version int
+	BankNum uint16
+
+	RAM []byte
+
+	Mode         byte
+	LDAImmediate bool
+
+	FastJumpCount  int
+	FastJumpStream byte
+
+	MusicCounters    [3]uint32
+	MusicFrequencies [3]uint32
+	MusicWaveSizes   [3]byte
+	MusicOscClock    int
+}
+
+func newCDF(rom []byte) mapper {
+	return newCDFVersion(cdfVersion(rom))
+}
+
+func newCDFVersion(version int) *cdf {
+	c := &cdf{Version: version}
+	if c.Version == cdfVersionJPlus {
+		c.RAM = make([]byte, cdfJPlusRAMSize)
+	} else {
+		c.RAM = make([]byte, cdfRAMSize)
+	}
+	return c
+}
+
+func (c *cdf) layout() *cdfLayout { return &cdfLayouts[c.Version] }
+
+func (c *cdf) fastFetchOn() bool    { return c.Mode&0x0f == 0 }
+func (c *cdf) digitalAudioOn() bool { return c.Mode&0xf0 == 0 }
+
+func (c *cdf) romByte(mem *mem, addr uint16) byte {
+	offset := cdfBankStart + int(c.BankNum)*4096 + int(addr&0xfff)
+	if offset >= len(mem.rom) {
+		return 0
+	}
+	return mem.rom[offset]
+}
+
+func (c *cdf) ram32(offset int) uint32 {
+	return binary.LittleEndian.Uint32(c.RAM[offset:])
+}
+func (c *cdf) setRAM32(offset int, val uint32) {
+	binary.LittleEndian.PutUint32(c.RAM[offset:], val)
+}
+
+func (c *cdf) streamPtr(index byte) uint32 {
+	return c.ram32(c.layout().streamBase + int(index)*4)
+}
+func (c *cdf) setStreamPtr(index byte, val uint32) {
+	c.setRAM32(c.layout().streamBase+int(index)*4, val)
+}
+func (c *cdf) streamInc(index byte) uint32 {
+	return c.ram32(c.layout().incrementBase + int(index)*4)
+}
+
+func (c *cdf) displayByte(ptr uint32) *byte {
+	offset := cdfDisplayStart + int(ptr>>c.layout().addrShift)
+	return &c.RAM[offset%len(c.RAM)]
+}
+
+func (c *cdf) readStream(index byte) byte {
+	ptr := c.streamPtr(index)
+	val := *c.displayByte(ptr)
+	c.setStreamPtr(index, ptr+c.streamInc(index)<<c.layout().incShift)
+	return val
+}
+
+// waveforms are stored as ARM addrs
+func (c *cdf) waveform(index int) uint32 {
+	return c.ram32(c.layout().waveformBase + index*4)
+}
+
+func (c *cdf) armByte(mem *mem, addr uint32) byte {
+	if addr < uint32(len(mem.rom)) {
+		return mem.rom[addr]
+	}
+	if addr >= thumbRAMBase && addr-thumbRAMBase < uint32(len(c.RAM)) {
+		return c.RAM[addr-thumbRAMBase]
+	}
+	return 0
+}
+
+func (c *cdf) amplitude(mem *mem) byte {
+	if c.digitalAudioOn() {
+		// packed 4-bit samples, high nybble first
+		counter, shift := c.MusicCounters[0], c.layout().sampleShift
+		val := c.armByte(mem, c.waveform(0)+counter>>shift)
+		if counter&(1<<(shift-1)) == 0 {
+			val >>= 4
+		}
+		return val & 0x0f
+	}
+	sum := byte(0)
+	for i := range c.MusicCounters {
+		offset := c.waveform(i) - thumbRAMBase + uint32(c.MusicCounters[i]>>c.MusicWaveSizes[i])
+		sum += c.RAM[int(offset)%len(c.RAM)]
+	}
+	return sum
+}
+
+func (c *cdf) read(mem *mem, addr uint16) byte {
+	addr &= 0xfff
+	val := c.romByte(mem, addr)
+
+	if c.FastJumpCount > 0 {
+		c.FastJumpCount--
+		ptr := c.streamPtr(c.FastJumpStream)
+		val = *c.displayByte(ptr)
+		c.setStreamPtr(c.FastJumpStream, ptr+1<<c.layout().addrShift)
+		return val
+	}
+
+	layout := c.layout()
+	if c.fastFetchOn() {
+		if c.LDAImmediate && val <= layout.amplitudeStream {
+			c.LDAImmediate = false
+			if val == layout.amplitudeStream {
+				return c.amplitude(mem)
+			}
+			return c.readStream(val)
+		}
+		c.LDAImmediate = false
+
+		// JMP $0000 (or $0001) jumps to the addr in a jump stream
+		if val == 0x4c {
+			lo, hi := c.romByte(mem, addr+1), c.romByte(mem, addr+2)
+			if lo&layout.jumpStreamMask == 0 && hi == 0 {
+				c.FastJumpCount = 2
+				c.FastJumpStream = cdfJumpStream + lo
+				return val
+			}
+		}
+	}
+
+	c.checkBankSwitch(addr)
+
+	if c.fastFetchOn() {
+		c.LDAImmediate = val == 0xa9
+		if c.Version == cdfVersionJPlus {
+			// CDFJ+ also fast fetches LDX # and LDY #
+			c.LDAImmediate = c.LDAImmediate || val == 0xa2 || val == 0xa0
+		}
+	}
+	return val
+}
+
+func (c *cdf) checkBankSwitch(addr uint16) {
+	if c.Version == cdfVersionJPlus {
+		if addr >= 0xff4 && addr <= 0xffb {
+			c.BankNum = addr - 0xff4
+		}
+	} else if addr >= 0xff5 && addr <= 0xffb {
+		c.BankNum = addr - 0xff5
+	}
+}
+
+func (c *cdf) write(mem *mem, addr uint16, val byte) {
+	addr &= 0xfff
+	shift := c.layout().addrShift
+	switch addr {
+	case 0xff0: // DSWRITE
+		ptr := c.streamPtr(cdfCommStream)
+		*c.displayByte(ptr) = val
+		c.setStreamPtr(cdfCommStream, ptr+1<<shift)
+	case 0xff1: // DSPTR
+		ptr := c.streamPtr(cdfCommStream)
+		ptr = (ptr<<8)&^(1<<(shift+8)-1) | uint32(val)<<shift
+		c.setStreamPtr(cdfCommStream, ptr)
+	case 0xff2: // SETMODE
+		c.Mode = val
+	case 0xff3: // CALLFN
+		// 0-2 were DPC+ functions, done by C code in CDF
+		if val == 254 || val == 255 {
+			c.runARMCode(mem)
+		}
+	}
+	c.checkBankSwitch(addr)
+}
+
+func (c *cdf) runARMCode(mem *mem) {
+	cpu := newThumbCPU(mem.rom, c.RAM, cdfCodeEntry, cdfCodeReturn)
+	cpu.driverCall = func(cpu *thumbCPU, addr uint32) bool {
+		if c.driverCall(cpu, addr) {
+			return true
+		}
+		if addr != cdfCodeReturn {
+			mem.log.warnOnce(LogMapper, fmt.Sprintf("CDF: unknown driver call 0x%04x", addr))
+		}
+		return false
+	}
+	if err := cpu.run(); err != nil {
+		mem.log.warnOnce(LogMapper, "CDF: "+err.Error())
+	}
+	mem.stallCycles += cpu.cpuCycles()
+}
+
+// the music routines the driver provides to the C code,
+// arguments in r2 and r3.
+func (c *cdf) driverCall(cpu *thumbCPU, addr uint32) bool {
+	voice := cpu.R[2] % 3
+	calls := &c.layout().driverCalls
+	switch addr {
+	case calls[0]: // set note
+		c.MusicFrequencies[voice] = cpu.R[3]
+	case calls[1]: // reset wave
+		c.MusicCounters[voice] = 0
+	case calls[2]: // get wave pointer
+		cpu.R[2] = c.MusicCounters[voice]
+	case calls[3]: // set wave size
+		c.MusicWaveSizes[voice] = byte(cpu.R[3])
+	default:
+		return false
+	}
+	return true
+}
+
+func (c *cdf) getMapperNum() uint16 { return 0xcdf }
+func (c *cdf) getBankNum() uint16   { return c.BankNum }
+func (c *cdf) runCycle(emu *emuState) {
+	cpuClocksPerSecond := int(ntscClocksPerSecond / 3)
+	if emu.TIA.TVFormat == FormatPAL {
+		cpuClocksPerSecond = int(palClocksPerSecond / 3)
+	}
+	if c.MusicOscClock += dpcOscillatorHz; c.MusicOscClock >= cpuClocksPerSecond {
+		c.MusicOscClock -= cpuClocksPerSecond
+		for i := range c.MusicCounters {
+			c.MusicCounters[i] += c.MusicFrequencies[i]
+		}
+	}
+}
+func (c *cdf) init(emu *emuState) {
+	copy(c.RAM[:cdfDriverSize], emu.Mem.rom)
+	for i := range c.MusicWaveSizes {
+		c.MusicWaveSizes[i] = cdfDefaultWaveSz
+	}
+	c.Mode = 0xff
+	if c.Version == cdfVersionJPlus {
+		c.BankNum = 0
+	} else {
+		c.BankNum = 6
+	}
+}
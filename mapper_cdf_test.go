@@ -0,0 +1,43 @@
+package vcsgo
+
+import "testing"
+
+func TestCDFDriverCalls(t *testing.T) {
+	for version := range cdfLayouts {
+		c := newCDFVersion(version)
+		calls := c.layout().driverCalls
+		cpu := &thumbCPU{}
+		cpu.R[2], cpu.R[3] = 1, 0x1234
+		if !c.driverCall(cpu, calls[0]) || c.MusicFrequencies[1] != 0x1234 {
+			t.Errorf("version %v: set note at 0x%04x didn't set the frequency", version, calls[0])
+		}
+		cpu.R[3] = 7
+		if !c.driverCall(cpu, calls[3]) || c.MusicWaveSizes[1] != 7 {
+			t.Errorf("version %v: set wave size at 0x%04x didn't set the size", version, calls[3])
+		}
+		if c.driverCall(cpu, cdfCodeReturn) {
+			t.Errorf("version %v: returning from the C code was taken as a driver call", version)
+		}
+	}
+}
+
+func TestCDFDigitalAudioSample(t *testing.T) {
+	rom := make([]byte, 64*1024)
+	rom[0x9001] = 0xa5
+	for version := range cdfLayouts {
+		c := newCDFVersion(version)
+		c.Mode = 0 // fast fetch and digital audio
+		c.setRAM32(c.layout().waveformBase, 0x9000)
+		shift := c.layout().sampleShift
+
+		mem := &mem{rom: rom}
+		c.MusicCounters[0] = 1 << shift
+		if got := c.amplitude(mem); got != 0x0a {
+			t.Errorf("version %v: high nybble got 0x%x, want 0xa", version, got)
+		}
+		c.MusicCounters[0] = 1<<shift | 1<<(shift-1)
+		if got := c.amplitude(mem); got != 0x05 {
+			t.Errorf("version %v: low nybble got 0x%x, want 0x5", version, got)
+		}
+	}
+}
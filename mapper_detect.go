@@ -1,42 +1,37 @@
 package vcsgo
 
 import (
-	"crypto/md5"
+	"bytes"
 	"fmt"
 )
 
-func findHash(hash string, list []string) bool {
-	for i := range list {
-		if hash == list[i] {
-			return true
-		}
-	}
-	return false
-}
 func loadMapperFromRomInfo(rom []byte) mapper {
-	hash := fmt.Sprintf("%x", md5.Sum(rom))
-	if findHash(hash, mapperListE0) {
-		return &mapperE0{}
-	}
-	if findHash(hash, mapperListE7) {
-		return &mapperE7{}
-	}
-	if findHash(hash, mapperListFE) {
-		return &mapperFE{}
+	if props, ok := lookupCartProperties(rom); ok && props.Mapper != "" {
+		if m, err := makeMapperFromName(props.Mapper, rom); err == nil {
+			return m
+		}
 	}
-	if findHash(hash, mapperListDC) {
-		return makeMapperDC()
+	if m := loadMapperFromScan(rom); m != nil {
+		return m
 	}
-	if findHash(hash, mapperListC0) {
-		return &mapperC0{}
+	return &mapperUnknown{}
+}
+
+// sizes guessMapperFromAddr can work with
+var guessableROMSizes = []int{8 * 1024, 16 * 1024, 32 * 1024, 64 * 1024, 128 * 1024, 256 * 1024}
+
+// validateMapper makes sure there's a way to run the cart, i.e.
+// it either has a mapper or one can be guessed as it runs.
+func validateMapper(emu *emuState) error {
+	if emu.Mem.mapper.getMapperNum() != 0 || emu.Mem.MapperPinned || len(emu.Mem.rom) <= 4096 {
+		return nil
 	}
-	switch len(rom) {
-	case 8*1024 + 256:
-		return &mapper66{}
-	case 12 * 1024:
-		return &mapperFA{}
+	for _, size := range guessableROMSizes {
+		if len(emu.Mem.rom) == size {
+			return nil
+		}
 	}
-	return &mapperUnknown{}
+	return fmt.Errorf("%w: can't find a mapper for a %d byte rom", ErrUnsupportedMapper, len(emu.Mem.rom))
 }
 
 func (emu *emuState) guessMapperFromAddr(addr uint16) mapper {
@@ -53,42 +48,66 @@ func (emu *emuState) guessMapperFromAddr(addr uint16) mapper {
 		lastAddr := emu.Mem.lastWriteAddr
 		return lastAddr != 0x003e && lastAddr != 0x0040
 	}
+	is3E := func(addr uint16) bool {
+		if addr != 0x003e {
+			return false
+		}
+		lastAddr := emu.Mem.lastWriteAddr
+		return lastAddr != 0x003d && lastAddr != 0x003f
+	}
+
+	// 3E games may well select a ROM bank before they ever touch
+	// RAM, so look for a STA $3E; LDA #0 to tell them apart
+	if is3E(addr) || (is3F(addr) && bytes.Contains(emu.Mem.rom, []byte{0x85, 0x3e, 0xa9, 0x00})) {
+		return &mapper3E{}
+	}
+	if is3F(addr) {
+		return &mapper3F{}
+	}
+
+	std := func(makeMapper, makeMapperSC func() mapper) mapper {
+		if hasSuperchip(emu.Mem.rom) {
+			return makeMapperSC()
+		}
+		return makeMapper()
+	}
 
 	switch len(emu.Mem.rom) {
 	case 8 * 1024:
 		if addr == 0x1ff8 || addr == 0x1ff9 {
-			return makeMapperF8()
-		}
-		if is3F(addr) {
-			return &mapper3F{}
+			return std(makeMapperF8, makeMapperF8SC)
 		}
 
 	case 16 * 1024:
 		if addr >= 0x1ff6 && addr <= 0x1ff9 {
-			return makeMapperF6()
-		}
-		if is3F(addr) {
-			return &mapper3F{}
+			return std(makeMapperF6, makeMapperF6SC)
 		}
 
 	case 32 * 1024:
 		if addr >= 0x1ff4 && addr <= 0x1ffb {
-			return makeMapperF4()
-		}
-		if is3F(addr) {
-			return &mapper3F{}
+			return std(makeMapperF4, makeMapperF4SC)
 		}
 
 	case 64 * 1024:
 		if addr == 0x1ff0 {
 			return &mapperF0{}
 		}
-		if is3F(addr) {
-			return &mapper3F{}
+		if addr >= 0x1fe0 && addr <= 0x1fef {
+			return std(makeMapperEF, makeMapperEFSC)
+		}
+
+	case 128 * 1024:
+		if addr >= 0x1fc0 && addr <= 0x1fdf {
+			return std(makeMapperDF, makeMapperDFSC)
+		}
+
+	case 256 * 1024:
+		if addr >= 0x1f80 && addr <= 0x1fbf {
+			return std(makeMapperBF, makeMapperBFSC)
 		}
 
 	default:
-		emuErr(fmt.Sprint("unknown rom size", len(emu.Mem.rom)))
+		emu.Mem.log.warnOnce(LogMapper, fmt.Sprintf("unknown rom size %d, no mapper guess", len(emu.Mem.rom)))
 	}
 	return emu.Mem.mapper
 }
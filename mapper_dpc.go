@@ -0,0 +1,232 @@
+package vcsgo
+
+// The DPC chip from Pitfall II. 8K of F8-style banked program
+// ROM, 2K of display ROM read through eight data fetchers, a
+// random number generator, and three fetchers that can be
+// clocked by an onboard oscillator to make square wave music.
+//
+// Registers live at 0x1000-0x107f and are mirrored at 0x1800.
+// Reads: index is addr&7, function is addr>>3&7
+//   0: random number (index 0-3), music amplitude (index 4-7)
+//   1: display data
+//   2: display data AND flag
+//   3: display data AND flag, nybbles swapped
+//   4: display data AND flag, bits reversed
+//   5: display data AND flag, rotated right
+//   6: display data AND flag, rotated left
+//   7: flag
+// Writes:
+//   0: top count, 1: bottom count, 2: counter low,
+//   3: counter high (bit 4 = music mode for fetchers 5-7),
+//   4: fetcher reset (counter low back to the top count),
+//   6: random number reset
+
+const dpcROMEnd = 8192 + 2048 - 1
+
+// The music oscillator is an RC circuit that varied from cart
+// to cart, this is the rate most emulators have settled on.
+const dpcOscillatorHz = 20000
+
+type dpc struct {
+	MapperF8 mapper
+	Ptrs     [8]dpcPtr
+	LFSR     byte
+	OscClock int
+}
+
+type dpcPtr struct {
+	Ptr       uint16
+	ShowStart byte
+	ShowEnd   byte
+	Show      bool
+	MusicMode bool
+}
+
+func (d *dpc) readLFSR() byte {
+	val := d.LFSR
+	d.LFSR = val<<1 | (^(val>>7 ^ val>>5 ^ val>>4 ^ val>>3) & 1)
+	return val
+}
+
+func makeMapperDC() mapper {
+	return &dpc{MapperF8: makeMapperF8()}
+}
+
+func (d *dpc) read(mem *mem, addr uint16) byte {
+	addr &= 0x1fff
+	regAddr := addr &^ 0x0800
+	if regAddr < 0x1040 {
+		return d.readReg(mem, regAddr)
+	} else if regAddr >= 0x1070 && regAddr <= 0x1077 {
+		d.LFSR = 0
+	}
+	return d.MapperF8.read(mem, addr)
+}
+
+func (d *dpc) readReg(mem *mem, addr uint16) byte {
+	index := addr & 7
+	p := &d.Ptrs[index]
+	p.updateMask()
+
+	var val byte
+	switch (addr >> 3) & 7 {
+	case 0:
+		if index < 4 {
+			val = d.readLFSR()
+		} else {
+			val = d.getMusic()
+		}
+	case 1:
+		val = p.fetch(mem)
+	case 2:
+		val = p.fetch(mem) & p.flag()
+	case 3:
+		val = p.fetch(mem) & p.flag()
+		val = val<<4 | val>>4
+	case 4:
+		val = reverseByte(p.fetch(mem) & p.flag())
+	case 5:
+		val = p.fetch(mem) & p.flag()
+		val = val>>1 | val<<7
+	case 6:
+		val = p.fetch(mem) & p.flag()
+		val = val<<1 | val>>7
+	case 7:
+		val = p.flag()
+	}
+
+	// music fetchers are clocked by the oscillator instead
+	if !p.MusicMode {
+		p.Ptr = (p.Ptr - 1) & 0x7ff
+	}
+	return val
+}
+
+func (d *dpc) write(mem *mem, addr uint16, val byte) {
+	addr &= 0x1fff
+	regAddr := addr &^ 0x0800
+	if regAddr >= 0x1040 && regAddr <= 0x107f {
+		d.writeReg(regAddr, val)
+	} else {
+		d.MapperF8.write(mem, addr, val)
+	}
+}
+
+func (d *dpc) writeReg(addr uint16, val byte) {
+	index := addr & 7
+	p := &d.Ptrs[index]
+	switch (addr >> 3) & 7 {
+	case 0:
+		p.setShowStart(val)
+	case 1:
+		p.setShowEnd(val)
+	case 2:
+		if p.MusicMode {
+			p.setLo(p.ShowStart)
+		} else {
+			p.setLo(val)
+		}
+	case 3:
+		p.setHi(val)
+		if index >= 5 {
+			// NOTE: bit 5 picks the music clock source, but
+			// every known cart uses the oscillator
+			p.MusicMode = val&0x10 != 0
+		}
+	case 4:
+		p.reset()
+	case 6:
+		d.LFSR = 0
+	}
+}
+
+func (d *dpc) getMapperNum() uint16 { return 0xdc }
+func (d *dpc) getBankNum() uint16   { return d.MapperF8.getBankNum() }
+func (d *dpc) runCycle(emu *emuState) {
+	cpuClocksPerSecond := int(ntscClocksPerSecond / 3)
+	if emu.TIA.TVFormat == FormatPAL {
+		cpuClocksPerSecond = int(palClocksPerSecond / 3)
+	}
+	if d.OscClock += dpcOscillatorHz; d.OscClock >= cpuClocksPerSecond {
+		d.OscClock -= cpuClocksPerSecond
+		for i := 5; i < 8; i++ {
+			if p := &d.Ptrs[i]; p.MusicMode {
+				p.clockMusic()
+			}
+		}
+	}
+}
+func (d *dpc) init(emu *emuState) {}
+
+var dpcMusicMixer = [8]byte{0, 4, 5, 9, 6, 10, 11, 15}
+
+func (d *dpc) getMusic() byte {
+	selector := d.Ptrs[5].getChannel()<<2 | d.Ptrs[6].getChannel()<<1 | d.Ptrs[7].getChannel()
+	val := dpcMusicMixer[selector]
+	return val
+}
+
+func (p *dpcPtr) getChannel() byte {
+	if p.MusicMode && p.Show {
+		return 1
+	}
+	return 0
+}
+func (p *dpcPtr) fetch(mem *mem) byte {
+	return mem.rom[dpcROMEnd-(p.Ptr&0x7ff)]
+}
+func (p *dpcPtr) flag() byte {
+	if p.Show {
+		return 0xff
+	}
+	return 0
+}
+func (p *dpcPtr) updateMask() {
+	if byte(p.Ptr) == p.ShowStart {
+		p.Show = true
+	} else if byte(p.Ptr) == p.ShowEnd {
+		p.Show = false
+	}
+}
+
+// in music mode, the low counter counts down from the top count
+// and wraps, making a square wave with a duty cycle set by the
+// bottom count.
+func (p *dpcPtr) clockMusic() {
+	lo := byte(p.Ptr)
+	if lo == 0 {
+		lo = p.ShowStart
+	} else {
+		lo--
+	}
+	if lo <= p.ShowEnd {
+		p.Show = false
+	} else if lo <= p.ShowStart {
+		p.Show = true
+	}
+	p.setLo(lo)
+}
+func (p *dpcPtr) setLo(lo byte) {
+	p.Ptr &= 0xff00
+	p.Ptr |= uint16(lo)
+}
+func (p *dpcPtr) setHi(hi byte) {
+	p.Ptr &= 0x00ff
+	p.Ptr |= uint16(hi&0x07) << 8
+}
+func (p *dpcPtr) setShowStart(val byte) {
+	p.ShowStart = val
+	p.Show = false
+}
+func (p *dpcPtr) setShowEnd(val byte) {
+	p.ShowEnd = val
+}
+
+// reset restarts a fetcher from its top count, as the patent's
+// draw line / music reset does. A music fetcher starts its wave
+// over from the top, so channels can be brought back in phase.
+// (Nothing known uses it, and Stella ignores these writes.)
+func (p *dpcPtr) reset() {
+	p.setLo(p.ShowStart)
+	p.Show = false
+}
@@ -0,0 +1,54 @@
+package vcsgo
+
+import "testing"
+
+func TestDPCFetcherReset(t *testing.T) {
+	rom := make([]byte, 8192+2048)
+	for i := 0; i < 2048; i++ {
+		rom[dpcROMEnd-i] = byte(i)
+	}
+	mem := &mem{rom: rom}
+	d := makeMapperDC().(*dpc)
+
+	// display fetcher 0, counting down from 0x121, so its
+	// flag goes on as it passes the top
+	d.write(mem, 0x1040, 0x20) // top
+	d.write(mem, 0x1048, 0x02) // bottom
+	d.write(mem, 0x1050, 0x21) // counter low
+	d.write(mem, 0x1058, 0x01) // counter high
+	d.read(mem, 0x1008)
+	d.read(mem, 0x1008)
+	d.read(mem, 0x1008)
+	if !d.Ptrs[0].Show {
+		t.Fatalf("display fetcher flag didn't go on")
+	}
+	d.write(mem, 0x1060, 0xff)
+	if d.Ptrs[0].Show {
+		t.Errorf("display fetcher flag still set after a reset")
+	}
+	if got := d.read(mem, 0x1008); got != 0x20 {
+		t.Errorf("display fetcher read 0x%02x after a reset, want 0x20", got)
+	}
+	// and it's at the top, so the flag goes on
+	if got := d.read(mem, 0x1038); got != 0xff {
+		t.Errorf("display fetcher flag 0x%02x after a reset and a read, want 0xff", got)
+	}
+
+	// music fetcher 5, part way through its wave, reset
+	// through the 0x1800 mirror
+	d.write(mem, 0x1045, 0x08)
+	d.write(mem, 0x104d, 0x03)
+	d.write(mem, 0x105d, 0x10) // music mode
+	d.write(mem, 0x1055, 0x00)
+	for i := 0; i < 3; i++ {
+		d.Ptrs[5].clockMusic()
+	}
+	d.write(mem, 0x1865, 0x00)
+	if p := d.Ptrs[5]; byte(p.Ptr) != 0x08 || p.Show {
+		t.Errorf("music fetcher at 0x%02x, flag %v after a reset, want 0x08, false", byte(p.Ptr), p.Show)
+	}
+	d.Ptrs[5].clockMusic()
+	if p := d.Ptrs[5]; byte(p.Ptr) != 0x07 || !p.Show {
+		t.Errorf("music fetcher at 0x%02x, flag %v after a clock, want 0x07, true", byte(p.Ptr), p.Show)
+	}
+}
@@ -0,0 +1,261 @@
+package vcsgo
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// DPC+ runs on the Harmony/Melody boards. The 32K image is the
+// 3K ARM driver, six 4K banks of 6507 code, 4K of display data
+// and 1K of frequency data. The display and frequency data are
+// copied into the ARM's 8K of RAM (after a copy of the driver),
+// where the data fetchers and the game's C code can get at them.
+//
+// The driver's job (fetchers, music, etc) is done natively here,
+// but C code called by CALLFUNCTION runs on the thumb interpreter.
+
+const (
+	dpcPlusImageSize    = 32 * 1024
+	dpcPlusBankStart    = 0x0c00
+	dpcPlusDisplayStart = 0x0c00
+	dpcPlusFreqStart    = 0x1c00
+	dpcPlusCodeEntry    = 0x0c08
+)
+
+func isDPCPlus(rom []byte) bool {
+	return bytes.Count(rom, []byte("DPC+")) >= 2
+}
+
+type dpcPlus struct {
+	BankNum uint16
+
+	RAM [8 * 1024]byte
+
+	Counters           [8]uint16
+	FracCounters       [8]uint32
+	FracIncrements     [8]byte
+	Tops, Bottoms      [8]byte
+	FastFetch          bool
+	LDAImmediate       bool
+	Params             [8]byte
+	ParamPtr           int
+	LFSR               uint32
+	MusicCounters      [3]uint32
+	MusicFrequencies   [3]uint32
+	MusicWaveforms     [3]byte
+	MusicOscillatorClk int
+
+	image []byte
+}
+
+func (d *dpcPlus) getImage(mem *mem) []byte {
+	if d.image == nil {
+		// older 29K images leave out the driver
+		d.image = make([]byte, dpcPlusImageSize)
+		rom := mem.rom
+		if len(rom) > dpcPlusImageSize {
+			rom = rom[:dpcPlusImageSize]
+		}
+		copy(d.image[dpcPlusImageSize-len(rom):], rom)
+	}
+	return d.image
+}
+
+func (d *dpcPlus) displayData() []byte { return d.RAM[dpcPlusDisplayStart:dpcPlusFreqStart] }
+
+func (d *dpcPlus) read(mem *mem, addr uint16) byte {
+	addr &= 0xfff
+	val := d.getImage(mem)[dpcPlusBankStart+int(d.BankNum)*4096+int(addr)]
+
+	// fast fetch mode turns LDA #<reg into a register read
+	if d.FastFetch && d.LDAImmediate && val < 0x28 {
+		addr = uint16(val)
+	}
+	d.LDAImmediate = false
+
+	if addr < 0x28 {
+		return d.readReg(addr)
+	}
+	if addr >= 0xff6 && addr <= 0xffb {
+		d.BankNum = addr - 0xff6
+	}
+	if d.FastFetch {
+		d.LDAImmediate = val == 0xa9
+	}
+	return val
+}
+
+func (d *dpcPlus) fetcherFlag(index uint16) byte {
+	top, bottom, lo := d.Tops[index], d.Bottoms[index], byte(d.Counters[index])
+	if top-lo > top-bottom {
+		return 0xff
+	}
+	return 0
+}
+
+func (d *dpcPlus) readReg(addr uint16) byte {
+	index := addr & 7
+	display := d.displayData()
+	var val byte
+	switch addr >> 3 {
+	case 0:
+		switch index {
+		case 0:
+			d.clockLFSR()
+			val = byte(d.LFSR)
+		case 1:
+			d.unclockLFSR()
+			val = byte(d.LFSR)
+		case 2, 3, 4:
+			val = byte(d.LFSR >> (8 * (index - 1)))
+		case 5:
+			sum := 0
+			for i := range d.MusicCounters {
+				sum += int(display[int(d.MusicWaveforms[i])<<5+int(d.MusicCounters[i]>>27)])
+			}
+			val = byte(sum)
+		}
+	case 1:
+		val = display[d.Counters[index]]
+		d.Counters[index] = (d.Counters[index] + 1) & 0xfff
+	case 2:
+		val = display[d.Counters[index]] & d.fetcherFlag(index)
+		d.Counters[index] = (d.Counters[index] + 1) & 0xfff
+	case 3:
+		val = display[d.FracCounters[index]>>8]
+		d.FracCounters[index] = (d.FracCounters[index] + uint32(d.FracIncrements[index])) & 0x0fffff
+	case 4:
+		if index < 4 {
+			val = d.fetcherFlag(index)
+		}
+	}
+	return val
+}
+
+func (d *dpcPlus) clockLFSR() {
+	feedback := uint32(0)
+	if d.LFSR&(1<<10) != 0 {
+		feedback = 0x10adab1e
+	}
+	d.LFSR = feedback ^ (d.LFSR>>11 | d.LFSR<<21)
+}
+
+func (d *dpcPlus) unclockLFSR() {
+	val := d.LFSR
+	if val&(1<<31) != 0 {
+		val ^= 0x10adab1e
+	}
+	d.LFSR = val<<11 | val>>21
+}
+
+func (d *dpcPlus) write(mem *mem, addr uint16, val byte) {
+	addr &= 0xfff
+	if addr < 0x28 || addr >= 0x80 {
+		if addr >= 0xff6 && addr <= 0xffb {
+			d.BankNum = addr - 0xff6
+		}
+		return
+	}
+
+	index := addr & 7
+	display := d.displayData()
+	switch (addr - 0x28) >> 3 {
+	case 0x0:
+		d.FracCounters[index] = d.FracCounters[index]&0x0f0000 | uint32(val)<<8
+	case 0x1:
+		d.FracCounters[index] = uint32(val&0x0f)<<16 | d.FracCounters[index]&0x00ffff
+	case 0x2:
+		d.FracIncrements[index] = val
+		d.FracCounters[index] &= 0x0fff00
+	case 0x3:
+		d.Tops[index] = val
+	case 0x4:
+		d.Bottoms[index] = val
+	case 0x5:
+		d.Counters[index] = d.Counters[index]&0x0f00 | uint16(val)
+	case 0x6:
+		switch index {
+		case 0:
+			d.FastFetch = val == 0
+		case 1:
+			if d.ParamPtr < len(d.Params) {
+				d.Params[d.ParamPtr] = val
+				d.ParamPtr++
+			}
+		case 2:
+			d.callFunction(mem, val)
+		case 5, 6, 7:
+			d.MusicWaveforms[index-5] = val & 0x7f
+		}
+	case 0x7:
+		d.Counters[index] = (d.Counters[index] - 1) & 0xfff
+		display[d.Counters[index]] = val
+	case 0x8:
+		d.Counters[index] = uint16(val&0x0f)<<8 | d.Counters[index]&0x00ff
+	case 0x9:
+		switch index {
+		case 0:
+			d.LFSR = 0x2b435044 // "DPC+"
+		case 1, 2, 3, 4:
+			shift := 8 * (index - 1)
+			d.LFSR = d.LFSR&^(0xff<<shift) | uint32(val)<<shift
+		case 5, 6, 7:
+			freqs := d.RAM[dpcPlusFreqStart:]
+			d.MusicFrequencies[index-5] = binary.LittleEndian.Uint32(freqs[int(val)*4:])
+		}
+	case 0xa:
+		display[d.Counters[index]] = val
+		d.Counters[index] = (d.Counters[index] + 1) & 0xfff
+	}
+}
+
+func (d *dpcPlus) callFunction(mem *mem, fn byte) {
+	display := d.displayData()
+	p := d.Params
+	switch fn {
+	case 0:
+		d.ParamPtr = 0
+	case 1: // copy ROM to fetcher
+		image := d.getImage(mem)
+		src := dpcPlusBankStart + (int(p[1])<<8 | int(p[0]))
+		dst := int(d.Counters[p[2]&7])
+		for i := 0; i < int(p[3]); i++ {
+			display[(dst+i)&0xfff] = image[(src+i)%len(image)]
+		}
+		d.ParamPtr = 0
+	case 2: // fill fetcher with value
+		dst := int(d.Counters[p[2]&7])
+		for i := 0; i < int(p[3]); i++ {
+			display[(dst+i)&0xfff] = p[0]
+		}
+		d.ParamPtr = 0
+	case 254, 255: // run C code (254 is with IRQ driven audio)
+		cpu := newThumbCPU(d.getImage(mem), d.RAM[:], dpcPlusCodeEntry, dpcPlusBankStart)
+		if err := cpu.run(); err != nil {
+			mem.log.warnOnce(LogMapper, "DPC+: "+err.Error())
+		}
+		mem.stallCycles += cpu.cpuCycles()
+	}
+}
+
+func (d *dpcPlus) getMapperNum() uint16 { return 0xdd }
+func (d *dpcPlus) getBankNum() uint16   { return d.BankNum }
+func (d *dpcPlus) runCycle(emu *emuState) {
+	cpuClocksPerSecond := int(ntscClocksPerSecond / 3)
+	if emu.TIA.TVFormat == FormatPAL {
+		cpuClocksPerSecond = int(palClocksPerSecond / 3)
+	}
+	if d.MusicOscillatorClk += dpcOscillatorHz; d.MusicOscillatorClk >= cpuClocksPerSecond {
+		d.MusicOscillatorClk -= cpuClocksPerSecond
+		for i := range d.MusicCounters {
+			d.MusicCounters[i] += d.MusicFrequencies[i]
+		}
+	}
+}
+func (d *dpcPlus) init(emu *emuState) {
+	image := d.getImage(&emu.Mem)
+	copy(d.RAM[:dpcPlusDisplayStart], image)
+	copy(d.RAM[dpcPlusDisplayStart:], image[dpcPlusBankStart+6*4096:])
+	d.LFSR = 0x2b435044 // "DPC+"
+	d.BankNum = 5
+}
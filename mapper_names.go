@@ -0,0 +1,104 @@
+package vcsgo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Names for pinning a cart's mapper instead of autodetecting it.
+// Mostly the same names other emulators (e.g. Stella) use.
+
+type mapperName struct {
+	name    string
+	aliases []string
+
+	// ROMs must be at least minSize, and one of sizes if
+	// there are any listed
+	minSize int
+	sizes   []int
+
+	make func(rom []byte) mapper
+}
+
+const kiB = 1024
+
+var mapperNames = []mapperName{
+	{"2K", nil, kiB / 2, []int{kiB / 2, kiB, 2 * kiB}, func([]byte) mapper { return &mapperUnknown{} }},
+	{"4K", nil, 4 * kiB, []int{4 * kiB}, func([]byte) mapper { return &mapperUnknown{} }},
+	{"CV", []string{"COMMAVID"}, 2 * kiB, []int{2 * kiB, 4 * kiB}, func([]byte) mapper { return &mapperC0{} }},
+	{"F8", nil, 8 * kiB, []int{8 * kiB}, func([]byte) mapper { return makeMapperF8() }},
+	{"F8SC", nil, 8 * kiB, []int{8 * kiB}, func([]byte) mapper { return makeMapperF8SC() }},
+	{"F6", nil, 16 * kiB, []int{16 * kiB}, func([]byte) mapper { return makeMapperF6() }},
+	{"F6SC", nil, 16 * kiB, []int{16 * kiB}, func([]byte) mapper { return makeMapperF6SC() }},
+	{"F4", nil, 32 * kiB, []int{32 * kiB}, func([]byte) mapper { return makeMapperF4() }},
+	{"F4SC", nil, 32 * kiB, []int{32 * kiB}, func([]byte) mapper { return makeMapperF4SC() }},
+	{"FA", []string{"CBS", "RAM+"}, 12 * kiB, []int{12 * kiB}, func([]byte) mapper { return &mapperFA{} }},
+	{"F0", []string{"MEGABOY"}, 64 * kiB, []int{64 * kiB}, func([]byte) mapper { return &mapperF0{} }},
+	{"E0", []string{"PARKER"}, 8 * kiB, []int{8 * kiB}, func([]byte) mapper { return &mapperE0{} }},
+	{"E7", []string{"MNETWORK"}, 16 * kiB, []int{16 * kiB}, func([]byte) mapper { return &mapperE7{} }},
+	{"FE", []string{"ACTIVISION"}, 8 * kiB, []int{8 * kiB}, func([]byte) mapper { return &mapperFE{} }},
+	{"3F", []string{"TIGERVISION"}, 2 * kiB, nil, func([]byte) mapper { return &mapper3F{} }},
+	{"3E", nil, 2 * kiB, nil, func([]byte) mapper { return &mapper3E{} }},
+	{"3E+", nil, kiB, nil, func([]byte) mapper { return &mapper3EPlus{} }},
+	{"DPC", []string{"PITFALL2"}, 10 * kiB, nil, func([]byte) mapper { return makeMapperDC() }},
+	{"DPC+", nil, 29 * kiB, nil, func([]byte) mapper { return &dpcPlus{} }},
+	{"CDF", nil, 32 * kiB, nil, newCDF},
+	{"CDFJ", nil, 32 * kiB, nil, func([]byte) mapper { return newCDFVersion(cdfVersionJ) }},
+	{"CDFJ+", nil, 32 * kiB, nil, func([]byte) mapper { return newCDFVersion(cdfVersionJPlus) }},
+	{"AR", []string{"SUPERCHARGER"}, arLoadSize, nil, func([]byte) mapper { return &mapper66{} }},
+	{"EF", nil, 64 * kiB, []int{64 * kiB}, func([]byte) mapper { return makeMapperEF() }},
+	{"EFSC", nil, 64 * kiB, []int{64 * kiB}, func([]byte) mapper { return makeMapperEFSC() }},
+	{"DF", nil, 128 * kiB, []int{128 * kiB}, func([]byte) mapper { return makeMapperDF() }},
+	{"DFSC", nil, 128 * kiB, []int{128 * kiB}, func([]byte) mapper { return makeMapperDFSC() }},
+	{"BF", nil, 256 * kiB, []int{256 * kiB}, func([]byte) mapper { return makeMapperBF() }},
+	{"BFSC", nil, 256 * kiB, []int{256 * kiB}, func([]byte) mapper { return makeMapperBFSC() }},
+	{"UA", nil, 8 * kiB, []int{8 * kiB}, func([]byte) mapper { return &mapperUA{} }},
+	{"SB", []string{"SUPERBANK"}, 128 * kiB, []int{128 * kiB, 256 * kiB}, func([]byte) mapper { return &mapperSB{} }},
+	{"0840", []string{"ECONOBANK"}, 8 * kiB, []int{8 * kiB}, func([]byte) mapper { return &mapper0840{} }},
+	{"X07", nil, 64 * kiB, []int{64 * kiB}, func([]byte) mapper { return &mapperX07{} }},
+	{"4A50", []string{"SUPERCAT"}, 32 * kiB, []int{32 * kiB, 64 * kiB, 128 * kiB}, func([]byte) mapper { return &mapper4A50{} }},
+	{"CM", []string{"COMPUMATE"}, 16 * kiB, []int{16 * kiB}, func([]byte) mapper { return &mapperCM{} }},
+}
+
+// fitsROM says whether the scheme can run a ROM of this size
+func (m *mapperName) fitsROM(size int) bool {
+	if size < m.minSize {
+		return false
+	}
+	if m.sizes == nil {
+		return true
+	}
+	for _, s := range m.sizes {
+		if size == s {
+			return true
+		}
+	}
+	return false
+}
+
+func findMapperName(name string) (*mapperName, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for i := range mapperNames {
+		m := &mapperNames[i]
+		if m.name == name {
+			return m, nil
+		}
+		for _, alias := range m.aliases {
+			if alias == name {
+				return m, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: unknown mapper name %q", ErrUnsupportedMapper, name)
+}
+
+func makeMapperFromName(name string, rom []byte) (mapper, error) {
+	m, err := findMapperName(name)
+	if err != nil {
+		return nil, err
+	}
+	if !m.fitsROM(len(rom)) {
+		return nil, fmt.Errorf("%w: %v can't run a %d byte rom", ErrUnsupportedMapper, m.name, len(rom))
+	}
+	return m.make(rom), nil
+}
@@ -0,0 +1,49 @@
+package vcsgo
+
+import (
+	"errors"
+	"testing"
+)
+
+// Forcing a mapper onto a ROM it can't fit is an error, never a
+// panic on the first bank switch.
+func TestForcedMapperROMSize(t *testing.T) {
+	rom := testKernel(func(a *asm) {}, func(a *asm) {})
+	fits := map[string]bool{"4K": true, "CV": true, "3F": true, "3E": true, "3E+": true}
+	for _, name := range MapperNames() {
+		_, err := NewEmulatorWithOptions(rom, Options{Mapper: name})
+		if fits[name] {
+			if err != nil {
+				t.Errorf("%v: %v", name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrUnsupportedMapper) {
+			t.Errorf("%v on a 4K rom: got %v, want ErrUnsupportedMapper", name, err)
+		}
+	}
+}
+
+func TestMapperFitsROM(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		size int
+		want bool
+	}{
+		{"F8", 8 * 1024, true},
+		{"F8", 16 * 1024, false},
+		{"3F", 6 * 1024, true},
+		{"3F", 1024, false},
+		{"AR", 3 * arLoadSize, true},
+		{"AR", 4096, false},
+		{"2K", 1024, true},
+	} {
+		m, err := findMapperName(c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.fitsROM(c.size); got != c.want {
+			t.Errorf("%v with %d bytes: got %v, want %v", c.name, c.size, got, c.want)
+		}
+	}
+}
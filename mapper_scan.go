@@ -0,0 +1,172 @@
+package vcsgo
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Static mapper detection. Rather than wait for a game to touch
+// a hotspot, look through the ROM for code that touches them
+// (e.g. LDA $1FF8, STA $3F) and for the signature strings that
+// homebrew schemes embed, scoring each scheme that fits.
+
+// below this, fall back to guessing at the first hotspot access
+const scanConfidenceThreshold = 0.5
+
+// opcodes with an absolute addr operand that games use to hit
+// hotspots: LDA, STA, BIT, NOP, LDX, LDY, STX, STY, CMP
+var hotspotOpcodes = [256]bool{
+	0xad: true, 0x8d: true, 0x2c: true, 0x0c: true, 0xae: true,
+	0xac: true, 0x8e: true, 0x8c: true, 0xcd: true,
+}
+
+// countHotspotRefs counts instructions that touch cart space
+// addrs (any mirror) between lo and hi.
+func countHotspotRefs(rom []byte, lo, hi uint16) int {
+	count := 0
+	for i := 0; i+2 < len(rom); i++ {
+		if !hotspotOpcodes[rom[i]] {
+			continue
+		}
+		addr := uint16(rom[i+2])<<8 | uint16(rom[i+1])
+		if addr&0x1000 != 0 && addr&0xfff >= lo && addr&0xfff <= hi {
+			count++
+		}
+	}
+	return count
+}
+
+// more hits, more confidence: 1 hit is a 1/3, 2 is 1/2, 8 is 4/5...
+func hitConfidence(hits int) float64 {
+	return float64(hits) / float64(hits+2)
+}
+
+var bankSignatures = []struct {
+	sig  string
+	size int
+	name string
+}{
+	{"EFSC", 64 * 1024, "EFSC"},
+	{"EFEF", 64 * 1024, "EF"},
+	{"DFSC", 128 * 1024, "DFSC"},
+	{"DFDF", 128 * 1024, "DF"},
+	{"BFSC", 256 * 1024, "BFSC"},
+	{"BFBF", 256 * 1024, "BF"},
+}
+
+var cdfVersionNames = [...]string{
+	cdfVersion0:     "CDF",
+	cdfVersion1:     "CDF",
+	cdfVersionJ:     "CDFJ",
+	cdfVersionJPlus: "CDFJ+",
+}
+
+// scanForMapper returns the mappers that could fit the rom,
+// most likely first.
+func scanForMapper(rom []byte) []MapperGuess {
+	var guesses []MapperGuess
+	add := func(name string, confidence float64) {
+		if confidence > 0 {
+			guesses = append(guesses, MapperGuess{Name: name, Confidence: confidence})
+		}
+	}
+	addIf := func(name string, found bool, confidence float64) {
+		if found {
+			add(name, confidence)
+		}
+	}
+
+	// signatures are as sure as it gets
+	addIf("3E+", is3EPlus(rom), 1)
+	addIf("DPC+", isDPCPlus(rom), 1)
+	if isCDF(rom) {
+		add(cdfVersionNames[cdfVersion(rom)], 1)
+	}
+	for _, s := range bankSignatures {
+		addIf(s.name, len(rom) == s.size && bytes.Contains(rom, []byte(s.sig)), 1)
+	}
+
+	addIf("AR", len(rom) > 0 && len(rom)%arLoadSize == 0, 0.9)
+	addIf("4A50", is4A50(rom), 0.9)
+	addIf("X07", isX07(rom), 0.8)
+	addIf("SB", isSB(rom), 0.8)
+	addIf("UA", isUA(rom), 0.8)
+	addIf("0840", is0840(rom), 0.8)
+
+	if len(rom) > 4*1024 {
+		// 3E games also select ROM banks through 0x3f
+		sta3E := bytes.Count(rom, []byte{0x85, 0x3e, 0xa9, 0x00})
+		sta3F := bytes.Count(rom, []byte{0x85, 0x3f})
+		if sta3E > 0 {
+			add("3E", hitConfidence(sta3E+sta3F))
+		} else {
+			add("3F", hitConfidence(sta3F))
+		}
+	}
+
+	// the standard schemes, SC or not
+	sc := ""
+	if hasSuperchip(rom) {
+		sc = "SC"
+	}
+
+	switch len(rom) {
+	case 8 * 1024:
+		add("F8"+sc, hitConfidence(countHotspotRefs(rom, 0xff8, 0xff9)))
+		add("E0", hitConfidence(countHotspotRefs(rom, 0xfe0, 0xff7)))
+		addIf("FE", containsAny(rom,
+			[]byte{0x20, 0x00, 0xd0, 0xc6, 0xc5}, // JSR $D000; DEC $C5
+			[]byte{0x20, 0xc3, 0xf8, 0xa5, 0x82}, // JSR $F8C3; LDA $82
+			[]byte{0xd0, 0xfb, 0x20, 0x73, 0xfe}, // BNE $FB; JSR $FE73
+			[]byte{0x20, 0x00, 0xf0, 0x84, 0xd6}, // JSR $F000; STY $D6
+		), 0.6)
+	case 12 * 1024:
+		add("FA", 0.9)
+	case 16 * 1024:
+		add("F6"+sc, hitConfidence(countHotspotRefs(rom, 0xff6, 0xff9)))
+		e7Hits := countHotspotRefs(rom, 0xfe0, 0xfeb)
+		add("E7", hitConfidence(e7Hits))
+		// any E7 hotspot use beats the CompuMate's signature
+		addIf("CM", isCM(rom) && e7Hits == 0, 0.8)
+	case 32 * 1024:
+		add("F4"+sc, hitConfidence(countHotspotRefs(rom, 0xff4, 0xffb)))
+	case 64 * 1024:
+		add("EF"+sc, hitConfidence(countHotspotRefs(rom, 0xfe0, 0xfef)))
+		add("F0", hitConfidence(countHotspotRefs(rom, 0xff0, 0xff0)))
+	case 128 * 1024:
+		add("DF"+sc, hitConfidence(countHotspotRefs(rom, 0xfc0, 0xfdf)))
+	case 256 * 1024:
+		add("BF"+sc, hitConfidence(countHotspotRefs(rom, 0xf80, 0xfbf)))
+	}
+
+	sort.SliceStable(guesses, func(i, j int) bool {
+		return guesses[i].Confidence > guesses[j].Confidence
+	})
+	return guesses
+}
+
+// The superchip's RAM sits over the first 256 bytes of every bank,
+// so those bytes of the ROM can't be used and are left as filler.
+func hasSuperchip(rom []byte) bool {
+	if len(rom) < 8*1024 || len(rom)%4096 != 0 {
+		return false
+	}
+	for bank := 0; bank < len(rom); bank += 4096 {
+		fill := rom[bank]
+		for _, b := range rom[bank : bank+256] {
+			if b != fill {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func loadMapperFromScan(rom []byte) mapper {
+	guesses := scanForMapper(rom)
+	if len(guesses) == 0 || guesses[0].Confidence < scanConfidenceThreshold {
+		return nil
+	}
+	m, _ := makeMapperFromName(guesses[0].Name, rom)
+	return m
+}
@@ -0,0 +1,174 @@
+package vcsgo
+
+import (
+	"fmt"
+	"testing"
+)
+
+// scanRom is a blank 16K rom with the given code sprinkled in
+func scanRom(code ...[]byte) []byte {
+	return scanRomSize(16*1024, code...)
+}
+
+func scanRomSize(size int, code ...[]byte) []byte {
+	rom := make([]byte, size)
+	at := 0x100
+	for _, c := range code {
+		at += copy(rom[at:], c) + 0x10
+	}
+	return rom
+}
+
+// noSC puts code where a superchip's RAM would be, as blank
+// banks pass for superchip filler
+func noSC(rom []byte) []byte {
+	rom[0x80] = 0xea
+	return rom
+}
+
+// ldaTimes is n LDA $1xxx instructions
+func ldaTimes(n int, addr uint16) []byte {
+	code := []byte{}
+	for i := 0; i < n; i++ {
+		code = append(code, 0xad, byte(addr), byte(addr>>8))
+	}
+	return code
+}
+
+func repeatBytes(n int, b []byte) [][]byte {
+	out := [][]byte{}
+	for i := 0; i < n; i++ {
+		out = append(out, b)
+	}
+	return out
+}
+
+func TestScanForMapper(t *testing.T) {
+	type scanCase struct {
+		name string
+		rom  []byte
+		want string // "" for no guess good enough to use
+	}
+	cases := []scanCase{}
+
+	// hotspot hits, by rom size
+	for _, h := range []struct {
+		size    int
+		hotspot uint16
+		name    string
+	}{
+		{8 * 1024, 0x1ff9, "F8"},
+		{16 * 1024, 0x1ff6, "F6"},
+		{32 * 1024, 0x1ffb, "F4"},
+		{64 * 1024, 0x1fe5, "EF"},
+		{128 * 1024, 0x1fd0, "DF"},
+		{256 * 1024, 0x1f80, "BF"},
+	} {
+		cases = append(cases,
+			scanCase{h.name + "SC", scanRomSize(h.size, ldaTimes(3, h.hotspot)), h.name + "SC"},
+			scanCase{h.name, noSC(scanRomSize(h.size, ldaTimes(3, h.hotspot))), h.name},
+			// through a mirror
+			scanCase{h.name + " at 0xf000", noSC(scanRomSize(h.size, ldaTimes(3, h.hotspot|0xe000))), h.name},
+		)
+	}
+
+	cdf := func(version byte) [][]byte {
+		return repeatBytes(3, []byte{'C', 'D', 'F', version})
+	}
+	cases = append(cases,
+		scanCase{"3E+", scanRomSize(32*1024, []byte("TJ3E")), "3E+"},
+		scanCase{"DPC+", scanRomSize(32*1024, []byte("DPC+"), []byte("DPC+")), "DPC+"},
+		scanCase{"CDF0", scanRomSize(32*1024, cdf(0)...), "CDF"},
+		scanCase{"CDF1", scanRomSize(32*1024, cdf(1)...), "CDF"},
+		scanCase{"CDFJ", scanRomSize(32*1024, cdf('J')...), "CDFJ"},
+		scanCase{"CDFJ+", scanRomSize(64*1024, []byte("PLUSCDFJ")), "CDFJ+"},
+		// signatures beat the hotspots
+		scanCase{"EFSC sig", noSC(scanRomSize(64*1024, []byte("EFSC"), ldaTimes(3, 0x1fe0))), "EFSC"},
+		scanCase{"EF sig", scanRomSize(64*1024, []byte("EFEF")), "EF"},
+		scanCase{"DFSC sig", noSC(scanRomSize(128*1024, []byte("DFSC"))), "DFSC"},
+		scanCase{"BFSC sig", noSC(scanRomSize(256*1024, []byte("BFSC"))), "BFSC"},
+		scanCase{"EFSC sig, wrong size", noSC(scanRomSize(32*1024, []byte("EFSC"))), ""},
+
+		scanCase{"3E", scanRomSize(8*1024, []byte{0x85, 0x3e, 0xa9, 0x00}, []byte{0x85, 0x3f}), "3E"},
+		scanCase{"3F", scanRomSize(8*1024, repeatBytes(3, []byte{0x85, 0x3f})...), "3F"},
+
+		scanCase{"blank", scanRomSize(8 * 1024), ""},
+		scanCase{"one hotspot hit", noSC(scanRomSize(8*1024, ldaTimes(1, 0x1ff8))), ""},
+	)
+
+	for _, c := range cases {
+		guesses := scanForMapper(c.rom)
+		got := ""
+		if len(guesses) > 0 && guesses[0].Confidence >= scanConfidenceThreshold {
+			got = guesses[0].Name
+		}
+		if got != c.want {
+			t.Errorf("%v: got %q, want %q (%v)", c.name, got, c.want, guesses)
+			continue
+		}
+
+		m := loadMapperFromScan(c.rom)
+		if c.want == "" {
+			if m != nil {
+				t.Errorf("%v: loaded mapper %02x, want none", c.name, m.getMapperNum())
+			}
+			continue
+		}
+		want, err := makeMapperFromName(c.want, c.rom)
+		if err != nil {
+			t.Errorf("%v: %v", c.name, err)
+		} else if m == nil || m.getMapperNum() != want.getMapperNum() {
+			t.Errorf("%v: loaded mapper %v, want %v", c.name, m, c.want)
+		}
+	}
+}
+
+// 3F is listed before the standard schemes, so it wins a tie
+func TestScanTieGoesTo3F(t *testing.T) {
+	for _, c := range []struct {
+		size    int
+		hotspot uint16
+		name    string
+	}{
+		{8 * 1024, 0x1ff8, "F8"},
+		{16 * 1024, 0x1ff6, "F6"},
+	} {
+		rom := noSC(scanRomSize(c.size, ldaTimes(2, c.hotspot), []byte{0x85, 0x3f}, []byte{0x85, 0x3f}))
+		guesses := scanForMapper(rom)
+		got := fmt.Sprint(guesses)
+		want := fmt.Sprint([]MapperGuess{{"3F", 0.5}, {c.name, 0.5}})
+		if got != want {
+			t.Errorf("%v tie: got %v, want %v", c.name, got, want)
+		}
+		if m := loadMapperFromScan(rom); m == nil || m.getMapperNum() != 0x3f {
+			t.Errorf("%v tie: loaded %v, want 3F", c.name, m)
+		}
+	}
+}
+
+func TestScanCompuMate(t *testing.T) {
+	staSWCHA := []byte{0x8d, 0x80, 0x02}
+	staF3FFX := []byte{0x9d, 0xff, 0xf3}
+	staF400Y := []byte{0x99, 0x00, 0xf4}
+	ldaE7 := []byte{0xad, 0xe4, 0xff}
+
+	for _, c := range []struct {
+		name string
+		rom  []byte
+		want string
+	}{
+		{"CM stores", scanRom(staSWCHA, staF3FFX, staF3FFX), "CM"},
+		{"other CM stores", scanRom(staF400Y, staF400Y), "CM"},
+		{"only one CM store", scanRom(staSWCHA, staF3FFX), ""},
+		{"E7 writing SWCHA", scanRom(staSWCHA, ldaE7, ldaE7, ldaE7), "E7"},
+		{"E7 with CM-like stores", scanRom(staF3FFX, staF3FFX, ldaE7, ldaE7, ldaE7), "E7"},
+	} {
+		got := ""
+		if guesses := scanForMapper(c.rom); len(guesses) > 0 && guesses[0].Confidence >= scanConfidenceThreshold {
+			got = guesses[0].Name
+		}
+		if got != c.want {
+			t.Errorf("%v: got %q, want %q (%v)", c.name, got, c.want, scanForMapper(c.rom))
+		}
+	}
+}
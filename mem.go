@@ -9,13 +9,57 @@ type mem struct {
 	mapper mapper
 
 	lastWriteAddr uint16 // unfortunately necessary for a mapper hack
-	lastReadAddr  uint16 // unfortunately necessary for a mapper hack
+
+	// set when the mapper was chosen by the user, so no guessing
+	MapperPinned bool
+
+	// for mappers that time things by bus activity (e.g. supercharger)
+	LastAccessAddr   uint16
+	DistinctAccesses uint64
+
+	// cycles the CPU must wait, e.g. for a cart's ARM coprocessor
+	stallCycles uint
+
+	// DataBus is the last value read or written. TIA reads only
+	// drive a bit or two, leaving this in the rest.
+	DataBus byte
+	// RandomizeUndrivenBits fills those bits from the RNG instead.
+	// It changes what games read, so it's kept in snapshots (and
+	// so movies) rather than taken from whoever loads them.
+	RandomizeUndrivenBits bool
+
+	log *logSink
+}
+
+func (m *mem) countAccess(addr uint16) {
+	if addr != m.LastAccessAddr {
+		m.LastAccessAddr = addr
+		m.DistinctAccesses++
+	}
+}
+
+// the bits the TIA drives on each read, the rest float
+var tiaReadDrivenBits = [16]byte{
+	0xc0, 0xc0, 0xc0, 0xc0, 0xc0, 0xc0, 0x80, 0xc0, // collisions
+	0x80, 0x80, 0x80, 0x80, 0x80, 0x80, // INPT0-5
+	0x00, 0x00, // nothing there
+}
+
+// undrivenBits is what floating bits read as: whatever's left
+// on the data bus, or noise if that's been asked for.
+func (emu *emuState) undrivenBits() byte {
+	if emu.Mem.RandomizeUndrivenBits {
+		return emu.RNG.byte()
+	}
+	return emu.Mem.DataBus
 }
 
 func (emu *emuState) read(addr uint16) byte {
 	origAddr := addr
 
-	if emu.Mem.mapper.getMapperNum() == 0 && len(emu.Mem.rom) > 4096 {
+	emu.Mem.countAccess(addr)
+
+	if emu.Mem.mapper.getMapperNum() == 0 && !emu.Mem.MapperPinned && len(emu.Mem.rom) > 4096 {
 		emu.Mem.mapper = emu.guessMapperFromAddr(addr)
 	}
 
@@ -30,35 +74,27 @@ func (emu *emuState) read(addr uint16) byte {
 		maskedAddr := addr & 0x0f
 		switch maskedAddr {
 		case 0x00:
-			val = byte(addr) &^ 0xc0
-			val |= boolBit(7, emu.TIA.Collisions.M0P1)
+			val = boolBit(7, emu.TIA.Collisions.M0P1)
 			val |= boolBit(6, emu.TIA.Collisions.M0P0)
 		case 0x01:
-			val = byte(addr) &^ 0xc0
-			val |= boolBit(7, emu.TIA.Collisions.M1P0)
+			val = boolBit(7, emu.TIA.Collisions.M1P0)
 			val |= boolBit(6, emu.TIA.Collisions.M1P1)
 		case 0x02:
-			val = byte(addr) &^ 0xc0
-			val |= boolBit(7, emu.TIA.Collisions.P0PF)
+			val = boolBit(7, emu.TIA.Collisions.P0PF)
 			val |= boolBit(6, emu.TIA.Collisions.P0BL)
 		case 0x03:
-			val = byte(addr) &^ 0xc0
-			val |= boolBit(7, emu.TIA.Collisions.P1PF)
+			val = boolBit(7, emu.TIA.Collisions.P1PF)
 			val |= boolBit(6, emu.TIA.Collisions.P1BL)
 		case 0x04:
-			val = byte(addr) &^ 0xc0
-			val |= boolBit(7, emu.TIA.Collisions.M0PF)
+			val = boolBit(7, emu.TIA.Collisions.M0PF)
 			val |= boolBit(6, emu.TIA.Collisions.M0BL)
 		case 0x05:
-			val = byte(addr) &^ 0xc0
-			val |= boolBit(7, emu.TIA.Collisions.M1PF)
+			val = boolBit(7, emu.TIA.Collisions.M1PF)
 			val |= boolBit(6, emu.TIA.Collisions.M1BL)
 		case 0x06:
-			val = byte(addr) &^ 0x80
-			val |= boolBit(7, emu.TIA.Collisions.BLPF)
+			val = boolBit(7, emu.TIA.Collisions.BLPF)
 		case 0x07:
-			val = byte(addr) &^ 0xc0
-			val |= boolBit(7, emu.TIA.Collisions.P0P1)
+			val = boolBit(7, emu.TIA.Collisions.P0P1)
 			val |= boolBit(6, emu.TIA.Collisions.M0M1)
 
 		case 0x08:
@@ -136,10 +172,8 @@ func (emu *emuState) read(addr uint16) byte {
 						(emu.RowSelKeypad1&8 > 0 && emu.Input.Keypad1[11])))
 			}
 			emu.JoystickButtonChecksThisFrame++
-
-			//case 0x0e, 0x0f:
-			// TODO: return garbage? switch to crash for debug purposes?
 		}
+		val |= emu.undrivenBits() &^ tiaReadDrivenBits[maskedAddr]
 
 	case !bitOn(12) && !bitOn(9) && bitOn(7):
 		val = emu.Mem.RAM[addr&0x7f]
@@ -181,26 +215,35 @@ func (emu *emuState) read(addr uint16) byte {
 		case 0x5, 0x07: // 0x285, 0x287
 			val = emu.Timer.readINSTAT()
 		default:
-			emuErr(fmt.Sprintf("impossible io read 0x%04x 0x%04x", addr, maskedAddr))
+			emu.halt(LogMem, fmt.Errorf("impossible io read 0x%04x 0x%04x", addr, maskedAddr))
 		}
 
 	case bitOn(12):
 		val = emu.Mem.mapper.read(&emu.Mem, addr)
 
 	default:
-		emuErr(fmt.Sprintf("unimplemented read: 0x%04x", addr))
+		emu.halt(LogMem, fmt.Errorf("%w: read(0x%04x)", ErrUnimplemented, addr))
+	}
+	if cm, ok := emu.Mem.mapper.(*mapperCM); ok && addr&0x1000 == 0 {
+		val = emu.compuMateInput(cm, addr, val)
+	}
+	if w, ok := emu.Mem.mapper.(busWatcher); ok && addr&0x1000 == 0 {
+		w.watchBus(&emu.Mem, addr, val)
 	}
 	if showMemReads {
 		fmt.Printf("read(0x%04x) = 0x%02x\n", origAddr, val)
 	}
-	emu.Mem.lastReadAddr = addr
+	emu.Mem.DataBus = val
 	return val
 }
 
 func (emu *emuState) write(addr uint16, val byte) {
 	origAddr := addr
 
-	if emu.Mem.mapper.getMapperNum() == 0 && len(emu.Mem.rom) > 4096 {
+	emu.Mem.countAccess(addr)
+	emu.Mem.DataBus = val
+
+	if emu.Mem.mapper.getMapperNum() == 0 && !emu.Mem.MapperPinned && len(emu.Mem.rom) > 4096 {
 		emu.Mem.mapper = emu.guessMapperFromAddr(addr)
 	}
 
@@ -219,13 +262,12 @@ func (emu *emuState) write(addr uint16, val byte) {
 
 		maskedAddr := addr & 0x3f
 
-		if emu.Mem.mapper.getMapperNum() == 0x3f {
+		switch emu.Mem.mapper.getMapperNum() {
+		case 0x3e, 0x3f, 0x13e:
 			emu.Mem.mapper.write(&emu.Mem, addr, val)
 		}
 
 		switch maskedAddr {
-		case 0x00:
-			emu.TIA.InVSync = val&0x02 != 0
 		case 0x01:
 			wasLatched := emu.Input45LatchMode
 			emu.Input45LatchMode = val&0x40 != 0
@@ -249,60 +291,9 @@ func (emu *emuState) write(addr uint16, val byte) {
 				emu.InputTimingPots = false
 			}
 
-			emu.TIA.InVBlank = val&0x02 != 0
+			emu.TIA.queueWrite(byte(maskedAddr), val)
 		case 0x02:
 			emu.TIA.WaitForHBlank = true
-		case 0x03:
-			emu.TIA.resetHorizCounter()
-		case 0x04:
-			emu.TIA.P0.RepeatMode = val & 0x07
-			emu.TIA.M0.RepeatMode = val & 0x07
-			emu.TIA.M0.Size = 1 << ((val >> 4) & 3)
-		case 0x05:
-			emu.TIA.P1.RepeatMode = val & 0x07
-			emu.TIA.M1.RepeatMode = val & 0x07
-			emu.TIA.M1.Size = 1 << ((val >> 4) & 3)
-		case 0x06:
-			emu.TIA.P0.ColorLuma = val & 0xfe
-		case 0x07:
-			emu.TIA.P1.ColorLuma = val & 0xfe
-		case 0x08:
-			emu.TIA.PlayfieldAndBallColorLuma = val & 0xfe
-		case 0x09:
-			emu.TIA.BGColorLuma = val & 0xfe
-		case 0x0a:
-			boolsFromByte(val,
-				nil, nil, nil, nil, nil,
-				&emu.TIA.PFAndBLHavePriority,
-				&emu.TIA.PlayfieldScoreColorMode,
-				&emu.TIA.PlayfieldReflect,
-			)
-			emu.TIA.BL.Size = 1 << ((val >> 4) & 3)
-		case 0x0b:
-			emu.TIA.P0.Reflect = val&0x08 != 0
-		case 0x0c:
-			emu.TIA.P1.Reflect = val&0x08 != 0
-		case 0x0d:
-			emu.TIA.PlayfieldToLoad &^= 0x0f0000
-			emu.TIA.PlayfieldToLoad |= uint32(reverseByte(val)&0x0f) << 16
-		case 0x0e:
-			emu.TIA.PlayfieldToLoad &^= 0x00ff00
-			emu.TIA.PlayfieldToLoad |= uint32(val) << 8
-		case 0x0f:
-			emu.TIA.PlayfieldToLoad &^= 0x0000ff
-			emu.TIA.PlayfieldToLoad |= uint32(reverseByte(val))
-
-		case 0x10:
-			emu.TIA.resetP0()
-		case 0x11:
-			emu.TIA.resetP1()
-		case 0x12:
-			emu.TIA.resetM0()
-		case 0x13:
-			emu.TIA.resetM1()
-		case 0x14:
-			emu.TIA.resetBL()
-
 		case 0x15:
 			emu.APU.Channel0.Control = val & 0x0f
 		case 0x16:
@@ -315,43 +306,8 @@ func (emu *emuState) write(addr uint16, val byte) {
 			emu.APU.Channel0.Volume = val & 0x0f
 		case 0x1a:
 			emu.APU.Channel1.Volume = val & 0x0f
-
-		case 0x1b:
-			emu.TIA.loadShapeP0(val)
-		case 0x1c:
-			emu.TIA.loadShapeP1(val)
-		case 0x1d:
-			emu.TIA.M0.Show = val&0x02 != 0
-		case 0x1e:
-			emu.TIA.M1.Show = val&0x02 != 0
-		case 0x1f:
-			emu.TIA.loadEnablBL(val&0x02 != 0)
-		case 0x20:
-			emu.TIA.P0.Vx = int8(val&0xf0) >> 4
-		case 0x21:
-			emu.TIA.P1.Vx = int8(val&0xf0) >> 4
-		case 0x22:
-			emu.TIA.M0.Vx = int8(val&0xf0) >> 4
-		case 0x23:
-			emu.TIA.M1.Vx = int8(val&0xf0) >> 4
-		case 0x24:
-			emu.TIA.BL.Vx = int8(val&0xf0) >> 4
-		case 0x25:
-			emu.TIA.DelayGRP0 = val&0x01 != 0
-		case 0x26:
-			emu.TIA.DelayGRP1 = val&0x01 != 0
-		case 0x27:
-			emu.TIA.DelayGRBL = val&0x01 != 0
-		case 0x28:
-			emu.TIA.HideM0 = val&0x02 != 0
-		case 0x29:
-			emu.TIA.HideM1 = val&0x02 != 0
-		case 0x2a:
-			emu.TIA.applyHorizMotion()
-		case 0x2b:
-			emu.TIA.clearHorizMotion()
-		case 0x2c:
-			emu.TIA.clearCollisions()
+		default:
+			emu.TIA.queueWrite(byte(maskedAddr), val)
 		}
 
 	case !bitOn(12) && !bitOn(9) && bitOn(7):
@@ -363,15 +319,18 @@ func (emu *emuState) write(addr uint16, val byte) {
 		maskedAddr := addr & 0x07
 		switch maskedAddr {
 		case 0x0: // 0x280
+			if cm, ok := emu.Mem.mapper.(*mapperCM); ok {
+				cm.writeSWCHA(val)
+			}
 			if emu.DDRModeMaskPortA == 0xff {
 				emu.RowSelKeypad0 = ^val >> 4
 				emu.RowSelKeypad1 = ^val & 0x0f
 				if emu.RowSelKeypad0 > 0 && !emu.EverSelectedKeypad0 {
-					fmt.Println("Keypad0 activated!")
+					emu.logf(LogInfo, LogInput, "Keypad0 activated!")
 					emu.EverSelectedKeypad0 = true
 				}
 				if emu.RowSelKeypad1 > 0 && !emu.EverSelectedKeypad1 {
-					fmt.Println("Keypad1 activated!")
+					emu.logf(LogInfo, LogInput, "Keypad1 activated!")
 					emu.EverSelectedKeypad1 = true
 				}
 			}
@@ -400,7 +359,7 @@ func (emu *emuState) write(addr uint16, val byte) {
 		case 0x7: // 0x287, 0x297
 			emu.Timer.writeAnyTIMT(1024, val)
 		default:
-			emuErr(fmt.Sprintf("TODO: io write 0x%04x 0x%04x", addr, maskedAddr))
+			emu.halt(LogMem, fmt.Errorf("%w: io write 0x%04x 0x%04x", ErrUnimplemented, addr, maskedAddr))
 		}
 
 	case bitOn(12):
@@ -408,7 +367,10 @@ func (emu *emuState) write(addr uint16, val byte) {
 		emu.Mem.mapper.write(&emu.Mem, addr, val)
 
 	default:
-		emuErr(fmt.Sprintf("unimplemented: write(0x%04x, 0x%02x)", origAddr, val))
+		emu.halt(LogMem, fmt.Errorf("%w: write(0x%04x, 0x%02x)", ErrUnimplemented, origAddr, val))
+	}
+	if w, ok := emu.Mem.mapper.(busWatcher); ok && addr&0x1000 == 0 {
+		w.watchBus(&emu.Mem, addr, val)
 	}
 
 	emu.Mem.lastWriteAddr = addr
@@ -0,0 +1,352 @@
+package vcsgo
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// A movie is a snapshot of where recording started, followed by
+// every change of input from then on. Emulation is deterministic,
+// so replaying the input at the same cycles plays the session back
+// exactly.
+//
+// File format (all ints are varints):
+//   "vcsgo movie\n", version
+//   ROM md5 (16 bytes), seed
+//   start cycle count, start frame count,
+//   cycles and frames from start to end
+//   snapshot length, snapshot
+//   event count, then per event:
+//     cycles since last event, frames since last event,
+//     input (movieInputSize bytes)
+
+const movieMagic = "vcsgo movie\n"
+
+const currentMovieVersion = 1
+
+type movieEvent struct {
+	Cycles uint64
+	Frame  int
+	Input  Input
+}
+
+type movie struct {
+	ROMHash  [16]byte
+	Seed     int64
+	Snapshot []byte
+
+	StartCycle uint64
+	StartFrame int
+	EndCycles  uint64
+	EndFrame   int
+
+	Events []movieEvent
+}
+
+type movieRecorder struct {
+	movie     movie
+	lastInput Input
+}
+
+func (emu *emuState) startMovieRecording() {
+	emu.movieRecorder = &movieRecorder{
+		movie: movie{
+			ROMHash:    md5.Sum(emu.Mem.rom),
+			Seed:       emu.Seed,
+			Snapshot:   emu.makeSnapshot(),
+			StartCycle: emu.Cycles,
+			StartFrame: emu.TIA.FrameCount,
+		},
+		lastInput: movieInputOnly(emu.Input),
+	}
+}
+
+func (emu *emuState) stopMovieRecording() []byte {
+	r := emu.movieRecorder
+	if r == nil {
+		return nil
+	}
+	emu.movieRecorder = nil
+	r.movie.EndCycles = emu.Cycles
+	r.movie.EndFrame = emu.TIA.FrameCount
+	return r.movie.marshal()
+}
+
+func (r *movieRecorder) record(emu *emuState, input Input) {
+	input = movieInputOnly(input)
+	if input == r.lastInput {
+		return
+	}
+	r.lastInput = input
+	r.movie.Events = append(r.movie.Events, movieEvent{
+		Cycles: emu.Cycles,
+		Frame:  emu.TIA.FrameCount,
+		Input:  input,
+	})
+}
+
+type moviePlayer struct {
+	movie     movie
+	nextEvent int
+}
+
+func (emu *emuState) playMovie(movieBytes []byte) (*emuState, error) {
+	m, err := unmarshalMovie(movieBytes)
+	if err != nil {
+		return nil, err
+	}
+	if m.ROMHash != md5.Sum(emu.Mem.rom) {
+		return nil, fmt.Errorf("movie was recorded with a different rom")
+	}
+	newState, err := emu.loadSnapshot(m.Snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("movie snapshot: %v", err)
+	}
+	newState.moviePlayer = &moviePlayer{movie: *m}
+	newState.moviePlayer.endIfDone(newState)
+	return newState, nil
+}
+
+func (emu *emuState) moviePlaying() bool {
+	return emu.moviePlayer != nil
+}
+
+// playMovieInput sets any input that was set by this point
+// in the recording.
+func (p *moviePlayer) playMovieInput(emu *emuState) {
+	events := p.movie.Events
+	for p.nextEvent < len(events) && events[p.nextEvent].Cycles <= emu.Cycles {
+		emu.setInput(events[p.nextEvent].Input)
+		p.nextEvent++
+	}
+}
+
+// endIfDone ends playback as soon as the step that ended the
+// recording has been played, so no extra step sneaks in.
+func (p *moviePlayer) endIfDone(emu *emuState) {
+	if p.nextEvent == len(p.movie.Events) && emu.Cycles >= p.movie.EndCycles {
+		emu.moviePlayer = nil
+	}
+}
+
+// only the controls, not the debug keyboard state
+func movieInputOnly(input Input) Input {
+	input.Keys = [256]bool{}
+	return input
+}
+
+// switches, joysticks, paddle buttons (4 bytes), paddle
+// positions (8), keypads (4), compumate (6)
+const movieInputSize = 22
+
+func encodeMovieInput(buf []byte, input *Input) {
+	joyBits := func(j Joystick) uint32 {
+		return uint32(byteFromBools(false, false, false,
+			j.Up, j.Down, j.Left, j.Right, j.Button))
+	}
+	flags := uint32(byteFromBools(false, false, false,
+		input.ResetButton, input.SelectButton, input.TVBWSwitch,
+		input.P0DifficultySwitch, input.P1DifficultySwitch))
+	flags |= joyBits(input.JoyP0) << 8
+	flags |= joyBits(input.JoyP1) << 16
+	flags |= uint32(byteFromBools(false, false, false, false,
+		input.Paddle0.Button, input.Paddle1.Button,
+		input.Paddle2.Button, input.Paddle3.Button)) << 24
+	binary.LittleEndian.PutUint32(buf[0:], flags)
+
+	paddles := []Paddle{input.Paddle0, input.Paddle1, input.Paddle2, input.Paddle3}
+	for i, p := range paddles {
+		binary.LittleEndian.PutUint16(buf[4+i*2:], uint16(p.Position))
+	}
+
+	keypadBits := func(k [12]bool) uint16 {
+		bits := uint16(0)
+		for i := range k {
+			if k[i] {
+				bits |= 1 << uint(i)
+			}
+		}
+		return bits
+	}
+	binary.LittleEndian.PutUint16(buf[12:], keypadBits(input.Keypad0))
+	binary.LittleEndian.PutUint16(buf[14:], keypadBits(input.Keypad1))
+
+	cm := uint64(0)
+	for row := range input.CompuMate.Keys {
+		for col := range input.CompuMate.Keys[row] {
+			if input.CompuMate.Keys[row][col] {
+				cm |= 1 << uint(row*10+col)
+			}
+		}
+	}
+	if input.CompuMate.Func {
+		cm |= 1 << 40
+	}
+	if input.CompuMate.Shift {
+		cm |= 1 << 41
+	}
+	for i := 0; i < 6; i++ {
+		buf[16+i] = byte(cm >> uint(i*8))
+	}
+}
+
+func decodeMovieInput(buf []byte) Input {
+	var input Input
+	flags := binary.LittleEndian.Uint32(buf[0:])
+	bit := func(n uint) bool { return flags&(1<<n) != 0 }
+	input.ResetButton = bit(4)
+	input.SelectButton = bit(3)
+	input.TVBWSwitch = bit(2)
+	input.P0DifficultySwitch = bit(1)
+	input.P1DifficultySwitch = bit(0)
+	joy := func(shift uint) Joystick {
+		return Joystick{
+			Up: bit(shift + 4), Down: bit(shift + 3), Left: bit(shift + 2),
+			Right: bit(shift + 1), Button: bit(shift),
+		}
+	}
+	input.JoyP0 = joy(8)
+	input.JoyP1 = joy(16)
+
+	paddles := []*Paddle{&input.Paddle0, &input.Paddle1, &input.Paddle2, &input.Paddle3}
+	for i, p := range paddles {
+		p.Button = bit(uint(24 + 3 - i))
+		p.Position = int16(binary.LittleEndian.Uint16(buf[4+i*2:]))
+	}
+
+	keypad := func(bits uint16) [12]bool {
+		var k [12]bool
+		for i := range k {
+			k[i] = bits&(1<<uint(i)) != 0
+		}
+		return k
+	}
+	input.Keypad0 = keypad(binary.LittleEndian.Uint16(buf[12:]))
+	input.Keypad1 = keypad(binary.LittleEndian.Uint16(buf[14:]))
+
+	cm := uint64(0)
+	for i := 0; i < 6; i++ {
+		cm |= uint64(buf[16+i]) << uint(i*8)
+	}
+	for row := range input.CompuMate.Keys {
+		for col := range input.CompuMate.Keys[row] {
+			input.CompuMate.Keys[row][col] = cm&(1<<uint(row*10+col)) != 0
+		}
+	}
+	input.CompuMate.Func = cm&(1<<40) != 0
+	input.CompuMate.Shift = cm&(1<<41) != 0
+	return input
+}
+
+func (m *movie) marshal() []byte {
+	buf := &bytes.Buffer{}
+	varint := func(v int64) {
+		var b [binary.MaxVarintLen64]byte
+		buf.Write(b[:binary.PutVarint(b[:], v)])
+	}
+	uvarint := func(v uint64) {
+		var b [binary.MaxVarintLen64]byte
+		buf.Write(b[:binary.PutUvarint(b[:], v)])
+	}
+
+	buf.WriteString(movieMagic)
+	uvarint(currentMovieVersion)
+	buf.Write(m.ROMHash[:])
+	varint(m.Seed)
+	uvarint(m.StartCycle)
+	varint(int64(m.StartFrame))
+	uvarint(m.EndCycles - m.StartCycle)
+	varint(int64(m.EndFrame - m.StartFrame))
+	uvarint(uint64(len(m.Snapshot)))
+	buf.Write(m.Snapshot)
+
+	uvarint(uint64(len(m.Events)))
+	lastCycles, lastFrame := m.StartCycle, m.StartFrame
+	var inputBuf [movieInputSize]byte
+	for i := range m.Events {
+		e := &m.Events[i]
+		uvarint(e.Cycles - lastCycles)
+		varint(int64(e.Frame - lastFrame))
+		lastCycles, lastFrame = e.Cycles, e.Frame
+		encodeMovieInput(inputBuf[:], &e.Input)
+		buf.Write(inputBuf[:])
+	}
+	return buf.Bytes()
+}
+
+func unmarshalMovie(movieBytes []byte) (*movie, error) {
+	if !bytes.HasPrefix(movieBytes, []byte(movieMagic)) {
+		return nil, fmt.Errorf("not a vcsgo movie")
+	}
+	r := bytes.NewReader(movieBytes[len(movieMagic):])
+
+	var err error
+	varint := func() int64 {
+		if err != nil {
+			return 0
+		}
+		var v int64
+		v, err = binary.ReadVarint(r)
+		return v
+	}
+	uvarint := func() uint64 {
+		if err != nil {
+			return 0
+		}
+		var v uint64
+		v, err = binary.ReadUvarint(r)
+		return v
+	}
+	read := func(p []byte) {
+		if err != nil {
+			return
+		}
+		_, err = io.ReadFull(r, p)
+	}
+
+	if version := uvarint(); err == nil && version != currentMovieVersion {
+		return nil, fmt.Errorf("unknown movie version %v", version)
+	}
+
+	m := &movie{}
+	read(m.ROMHash[:])
+	m.Seed = varint()
+	m.StartCycle = uvarint()
+	m.StartFrame = int(varint())
+	m.EndCycles = m.StartCycle + uvarint()
+	m.EndFrame = m.StartFrame + int(varint())
+	snapLen := uvarint()
+	if err == nil && snapLen > uint64(r.Len()) {
+		return nil, fmt.Errorf("movie snapshot cut short")
+	}
+	m.Snapshot = make([]byte, snapLen)
+	read(m.Snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("movie header: %v", err)
+	}
+
+	numEvents := uvarint()
+	if err == nil && numEvents > uint64(r.Len()/movieInputSize) {
+		return nil, fmt.Errorf("movie events cut short")
+	}
+	m.Events = make([]movieEvent, 0, numEvents)
+	lastCycles, lastFrame := m.StartCycle, m.StartFrame
+	var inputBuf [movieInputSize]byte
+	for i := uint64(0); i < numEvents && err == nil; i++ {
+		lastCycles += uvarint()
+		lastFrame += int(varint())
+		read(inputBuf[:])
+		m.Events = append(m.Events, movieEvent{
+			Cycles: lastCycles,
+			Frame:  lastFrame,
+			Input:  decodeMovieInput(inputBuf[:]),
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("movie events: %v", err)
+	}
+	return m, nil
+}
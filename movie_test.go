@@ -0,0 +1,185 @@
+package vcsgo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// movieTestROM folds the joystick and an undriven (so random)
+// TIA read into RAM every frame, and paints the background
+// from it, so any drift in replay shows up on screen.
+func movieTestROM() []byte {
+	a := &asm{}
+	a.lda(2)
+	a.sta(0x00) // VSYNC
+	a.wsync()
+	a.wsync()
+	a.wsync()
+	a.lda(0)
+	a.sta(0x00)
+	a.op(0xad, 0x80, 0x02) // LDA SWCHA
+	a.op(0x45, 0x80)       // EOR $80
+	a.op(0x0a)             // ASL
+	a.op(0x65, 0x0c)       // ADC INPT4
+	a.sta(0x80)
+	a.op(0xa2, 200) // LDX #200
+	loop := len(a.b)
+	a.wsync()
+	a.op(0x8a)       // TXA
+	a.op(0x65, 0x80) // ADC $80
+	a.sta(0x09)      // COLUBK
+	a.op(0xca)       // DEX
+	a.op(0xd0, byte(loop-(len(a.b)+2)))
+	a.op(0x4c, 0x00, 0xf0) // JMP $f000
+
+	rom := make([]byte, 4096)
+	copy(rom, a.b)
+	rom[0xffc], rom[0xffd] = 0x00, 0xf0
+	return rom
+}
+
+// moviePlayInput is what the tester does on each frame
+func moviePlayInput(frame int) Input {
+	return Input{
+		JoyP0: Joystick{
+			Up:     frame/3%2 == 0,
+			Left:   frame%5 == 0,
+			Button: frame%7 < 2,
+		},
+		JoyP1:        Joystick{Right: frame%11 == 0},
+		SelectButton: frame == 20,
+	}
+}
+
+func runMovieFrames(emu *emuState, frames int, input func(frame int) Input) {
+	for f := 0; f < frames; f++ {
+		for !emu.FlipRequested() {
+			if input != nil {
+				emu.SetInput(input(f))
+			}
+			emu.Step()
+		}
+	}
+}
+
+func TestMovieReplaysBitExact(t *testing.T) {
+	rom := movieTestROM()
+	for _, c := range []struct {
+		name       string
+		recordOpts Options
+		playOpts   Options
+	}{
+		{
+			"same options",
+			Options{Seed: 42, RandomizeUndrivenTIABits: true, ForceTVFormat: true},
+			Options{Seed: 42, RandomizeUndrivenTIABits: true, ForceTVFormat: true},
+		},
+		// the recording's settings win over the player's
+		{
+			"played without random bits",
+			Options{Seed: 42, RandomizeUndrivenTIABits: true, ForceTVFormat: true},
+			Options{Seed: 3, ForceTVFormat: true},
+		},
+		{
+			"played with random bits",
+			Options{Seed: 42, ForceTVFormat: true},
+			Options{Seed: 3, RandomizeUndrivenTIABits: true, ForceTVFormat: true},
+		},
+	} {
+		emu, err := newState(rom, c.recordOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runMovieFrames(emu, 10, nil)
+		emu.StartMovieRecording()
+		runMovieFrames(emu, 60, moviePlayInput)
+		movieBytes := emu.StopMovieRecording()
+
+		// a fresh emulator, so nothing can leak over from the recording
+		other, err := newState(rom, c.playOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		played, err := other.PlayMovie(movieBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := played.(*emuState)
+		for p.MoviePlaying() {
+			p.SetInput(Input{JoyP0: Joystick{Down: true}}) // ignored during playback
+			p.Step()
+		}
+
+		if p.Cycles != emu.Cycles || p.TIA.FrameCount != emu.TIA.FrameCount {
+			t.Errorf("%v: playback ended at cycle %v, frame %v, want cycle %v, frame %v",
+				c.name, p.Cycles, p.TIA.FrameCount, emu.Cycles, emu.TIA.FrameCount)
+		}
+		if p.Mem.RAM != emu.Mem.RAM {
+			t.Errorf("%v: RAM differs after playback", c.name)
+		}
+		if pc, ec := &p.CPU, &emu.CPU; pc.PC != ec.PC || pc.A != ec.A || pc.X != ec.X || pc.Y != ec.Y || pc.P != ec.P || pc.S != ec.S {
+			t.Errorf("%v: CPU regs differ after playback", c.name)
+		}
+		if !bytes.Equal(p.TIA.Screen[:], emu.TIA.Screen[:]) {
+			t.Errorf("%v: screen differs after playback", c.name)
+		}
+	}
+}
+
+func TestMovieMarshalRoundTrip(t *testing.T) {
+	m := movie{
+		Seed:       -7,
+		Snapshot:   []byte("snap"),
+		StartCycle: 1000,
+		StartFrame: 3,
+		EndCycles:  90000,
+		EndFrame:   5,
+		Events: []movieEvent{
+			{Cycles: 1000, Frame: 3, Input: Input{ResetButton: true, Paddle1: Paddle{Position: -42, Button: true}}},
+			{Cycles: 50000, Frame: 4, Input: Input{JoyP1: Joystick{Up: true}, Keypad0: [12]bool{3: true}}},
+		},
+	}
+	m.ROMHash[0] = 0xab
+	got, err := unmarshalMovie(m.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.marshal()) != string(m.marshal()) || got.Events[1].Input != m.Events[1].Input {
+		t.Errorf("got %+v, want %+v", got, m)
+	}
+}
+
+func TestMovieErrors(t *testing.T) {
+	rom := movieTestROM()
+	emu, err := newState(rom, Options{ForceTVFormat: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	emu.StartMovieRecording()
+	runMovieFrames(emu, 2, moviePlayInput)
+	movieBytes := emu.StopMovieRecording()
+
+	otherROM := movieTestROM()
+	otherROM[0xfff] = 0x01
+	other, err := newState(otherROM, Options{ForceTVFormat: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name  string
+		emu   *emuState
+		movie []byte
+		want  string
+	}{
+		{"other rom", other, movieBytes, "different rom"},
+		{"not a movie", emu, []byte("hello"), "not a vcsgo movie"},
+		{"cut short", emu, movieBytes[:len(movieBytes)/2], "cut short"},
+	} {
+		_, err := c.emu.PlayMovie(c.movie)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%v: got %v, want an error containing %q", c.name, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package vcsgo
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io/ioutil"
+)
+
+// Rewind keeps a state every few frames in a ring buffer. Only the
+// newest state is kept whole; each older one is kept as a delta
+// against the one after it (the screen XOR'd, the rest compressed
+// with the newer state as a dictionary). Stepping back decodes the
+// newest delta, and dropping the oldest state never breaks a chain.
+
+// a whole state, or a delta
+type rewindState struct {
+	frame  int
+	screen []byte
+	state  []byte
+}
+
+type rewindBuffer struct {
+	capacity int
+	interval int
+
+	newest    *rewindState
+	deltas    []rewindState // ring, oldest at start
+	start     int
+	numDeltas int
+
+	lastFrame int
+}
+
+func newRewindBuffer(capacity, interval int) *rewindBuffer {
+	if interval < 1 {
+		interval = 1
+	}
+	return &rewindBuffer{
+		capacity:  capacity,
+		interval:  interval,
+		deltas:    make([]rewindState, capacity),
+		lastFrame: -1,
+	}
+}
+
+// The state is kept the way binary snapshots keep it, which
+// leaves out the screen. It's kept separately so it can be XOR'd
+// against its neighbors.
+func (emu *emuState) captureRewindState() *rewindState {
+	e := &binEncoder{}
+	emu.encodeBinState(e)
+	screen := make([]byte, len(emu.TIA.Screen))
+	copy(screen, emu.TIA.Screen[:])
+	return &rewindState{frame: emu.TIA.FrameCount, screen: screen, state: e.buf}
+}
+
+func (emu *emuState) restoreRewindState(s *rewindState) error {
+	newState, err := decodeBinState(&binDecoder{buf: s.state})
+	if err != nil {
+		return err
+	}
+	copy(newState.TIA.Screen[:], s.screen)
+
+	emu.carryOver(newState)
+	newState.rewind = emu.rewind
+	newState.APU.buffer = emu.APU.buffer
+
+	*emu = *newState
+	emu.hookCPU() // hooks pointed at newState
+	return nil
+}
+
+// captureFrame is called after each step, keeping a state
+// whenever a new frame starts on the interval.
+func (r *rewindBuffer) captureFrame(emu *emuState) {
+	frame := emu.TIA.FrameCount
+	if frame == r.lastFrame || frame%r.interval != 0 {
+		return
+	}
+	r.lastFrame = frame
+
+	s := emu.captureRewindState()
+	if r.newest != nil {
+		if err := r.pushDelta(r.newest, s); err != nil {
+			emu.logf(LogWarn, LogCart, "rewind: %v", err)
+			r.clear()
+		}
+	}
+	r.newest = s
+}
+
+func (r *rewindBuffer) clear() {
+	r.newest = nil
+	r.start, r.numDeltas = 0, 0
+}
+
+func (r *rewindBuffer) pushDelta(older, newer *rewindState) error {
+	screen := make([]byte, len(older.screen))
+	for i := range screen {
+		screen[i] = older.screen[i] ^ newer.screen[i]
+	}
+	screenDelta, err := deflateDict(screen, nil)
+	if err != nil {
+		return err
+	}
+	stateDelta, err := deflateDict(older.state, newer.state)
+	if err != nil {
+		return err
+	}
+	d := rewindState{frame: older.frame, screen: screenDelta, state: stateDelta}
+
+	if r.numDeltas == r.capacity {
+		// drop the oldest
+		r.start = (r.start + 1) % r.capacity
+		r.numDeltas--
+	}
+	r.deltas[(r.start+r.numDeltas)%r.capacity] = d
+	r.numDeltas++
+	return nil
+}
+
+// popDelta makes the newest delta into the newest state
+func (r *rewindBuffer) popDelta() (*rewindState, error) {
+	if r.numDeltas == 0 {
+		return nil, fmt.Errorf("no more rewind states")
+	}
+	i := (r.start + r.numDeltas - 1) % r.capacity
+	d := r.deltas[i]
+	r.deltas[i] = rewindState{}
+	r.numDeltas--
+
+	screen, err := inflateDict(d.screen, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(screen) != len(r.newest.screen) {
+		return nil, fmt.Errorf("bad rewind screen delta")
+	}
+	for j := range screen {
+		screen[j] ^= r.newest.screen[j]
+	}
+	state, err := inflateDict(d.state, r.newest.state)
+	if err != nil {
+		return nil, err
+	}
+	return &rewindState{frame: d.frame, screen: screen, state: state}, nil
+}
+
+// stepBack restores the last state from before the current
+// frame, returning false if there isn't one.
+func (r *rewindBuffer) stepBack(emu *emuState) bool {
+	if r.newest != nil && r.newest.frame >= emu.TIA.FrameCount {
+		// already here, go to the one before
+		older, err := r.popDelta()
+		if err != nil {
+			return false
+		}
+		r.newest = older
+	}
+	if r.newest == nil {
+		return false
+	}
+	if err := emu.restoreRewindState(r.newest); err != nil {
+		emu.logf(LogWarn, LogCart, "rewind: %v", err)
+		r.clear()
+		return false
+	}
+	r.lastFrame = r.newest.frame
+	return true
+}
+
+func deflateDict(data, dict []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w, err := flate.NewWriterDict(buf, flate.BestSpeed, dict)
+	if err != nil {
+		return nil, err
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func inflateDict(data, dict []byte) ([]byte, error) {
+	r := flate.NewReaderDict(bytes.NewReader(data), dict)
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,99 @@
+package vcsgo
+
+import (
+	"bytes"
+	"testing"
+)
+
+type rewindCheck struct {
+	cycles uint64
+	pc     uint16
+	ram    [128]byte
+	screen []byte
+}
+
+func rewindCheckOf(emu *emuState) rewindCheck {
+	return rewindCheck{
+		cycles: emu.Cycles,
+		pc:     emu.CPU.PC,
+		ram:    emu.Mem.RAM,
+		screen: append([]byte{}, emu.TIA.Screen[:]...),
+	}
+}
+
+// runRewindFrames plays frames, noting what the emulator looked
+// like at each point the rewind buffer keeps a state.
+func runRewindFrames(emu *emuState, frames, interval int, kept map[int]rewindCheck) {
+	for f := 0; f < frames; f++ {
+		for !emu.FlipRequested() {
+			frame := emu.TIA.FrameCount
+			emu.SetInput(moviePlayInput(frame))
+			emu.Step()
+			if emu.TIA.FrameCount != frame && emu.TIA.FrameCount%interval == 0 {
+				kept[emu.TIA.FrameCount] = rewindCheckOf(emu)
+			}
+		}
+	}
+}
+
+func TestRewindAcrossRingWrap(t *testing.T) {
+	const capacity, interval = 8, 2
+	emu, err := newState(movieTestROM(), Options{
+		Seed: 7, RandomizeUndrivenTIABits: true, ForceTVFormat: true,
+		RewindCapacity: capacity, RewindInterval: interval,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := map[int]rewindCheck{}
+	// many times the ring's size, so it wraps over and over
+	runRewindFrames(emu, 5*capacity*interval, interval, kept)
+	lastFrame := emu.TIA.FrameCount
+
+	steps := 0
+	for emu.StepBack() {
+		steps++
+		frame := emu.TIA.FrameCount
+		if want := lastFrame - steps*interval; frame != want {
+			t.Fatalf("step back %d went to frame %d, want %d", steps, frame, want)
+		}
+		want := kept[frame]
+		got := rewindCheckOf(emu)
+		if got.cycles != want.cycles || got.pc != want.pc || got.ram != want.ram {
+			t.Errorf("frame %d: restored cycle %v, pc %04x, want cycle %v, pc %04x (or RAM differs)",
+				frame, got.cycles, got.pc, want.cycles, want.pc)
+		}
+		if !bytes.Equal(got.screen, want.screen) {
+			t.Errorf("frame %d: restored screen differs", frame)
+		}
+	}
+	if steps != capacity {
+		t.Errorf("stepped back %d times, want %d (the ring's capacity)", steps, capacity)
+	}
+
+	// playing on from the oldest state retraces the same frames,
+	// and the buffer fills back up behind it
+	from := emu.TIA.FrameCount
+	retraced := map[int]rewindCheck{}
+	runRewindFrames(emu, 2*interval, interval, retraced)
+	for frame, got := range retraced {
+		want := kept[frame]
+		if got.cycles != want.cycles || got.ram != want.ram || !bytes.Equal(got.screen, want.screen) {
+			t.Errorf("frame %d differs when played again from frame %d", frame, from)
+		}
+	}
+	if !emu.StepBack() {
+		t.Errorf("can't step back after playing on from a rewind")
+	}
+}
+
+func TestRewindOff(t *testing.T) {
+	emu, err := newState(movieTestROM(), Options{ForceTVFormat: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runRewindFrames(emu, 4, 1, map[int]rewindCheck{})
+	if emu.StepBack() {
+		t.Errorf("stepped back with rewind off")
+	}
+}
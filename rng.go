@@ -0,0 +1,28 @@
+package vcsgo
+
+// rng is the emulator's own seeded random number generator
+// (splitmix64). Its state is marshalled in snapshots, so a run
+// from a snapshot or a seed is the same every time.
+type rng struct {
+	State uint64
+}
+
+func newRNG(seed int64) rng {
+	return rng{State: uint64(seed)}
+}
+
+func (r *rng) next() uint64 {
+	r.State += 0x9e3779b97f4a7c15
+	z := r.State
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
+
+func (r *rng) byte() byte { return byte(r.next()) }
+
+func (r *rng) read(p []byte) {
+	for i := range p {
+		p[i] = r.byte()
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"io/ioutil"
 )
 
-const currentSnapshotVersion = 1
+const currentSnapshotVersion = 4
 
 const infoString = "vcsgo snapshot"
 
@@ -20,7 +20,13 @@ type snapshot struct {
 	Mapper  marshalledMapper
 }
 
+// loadSnapshot takes binary snapshots, or the gzipped JSON
+// ones older versions made.
 func (emu *emuState) loadSnapshot(snapBytes []byte) (*emuState, error) {
+	if isBinSnapshot(snapBytes) {
+		return emu.loadBinSnapshot(snapBytes)
+	}
+
 	var err error
 	var reader io.Reader
 	var unpackedBytes []byte
@@ -53,16 +59,46 @@ func (emu *emuState) convertLatestSnapshot(snap *snapshot) (*emuState, error) {
 		return nil, err
 	}
 
+	return emu.loadedState(&newState), nil
+}
+
+// loadedState sets up a state loaded from a snapshot to take
+// over from this one.
+func (emu *emuState) loadedState(newState *emuState) *emuState {
+	emu.carryOver(newState)
+
+	// history from before the load doesn't lead here
+	if emu.rewind != nil {
+		newState.rewind = newRewindBuffer(emu.rewind.capacity, emu.rewind.interval)
+	}
+
+	// the screen isn't in binary snapshots, so
+	// keep showing this one until the next frame
+	newState.TIA.Screen = emu.TIA.Screen
+
+	return newState
+}
+
+// carryOver hands the parts of a session that aren't
+// marshalled over to a newly unmarshalled state.
+func (emu *emuState) carryOver(newState *emuState) {
 	newState.Mem.rom = emu.Mem.rom
 
-	newState.CPU.Write = newState.write
-	newState.CPU.Read = newState.read
-	newState.CPU.RunCycles = newState.runCycles
-	newState.CPU.Err = func(e error) { emuErr(e) }
+	newState.hookCPU()
 
 	newState.devMode = emu.devMode
+	newState.setLogSink(emu.Mem.log)
+	newState.APU.sampleRate = emu.APU.sampleRate
+	newState.TIA.hideHMoveComb = emu.TIA.hideHMoveComb
+	newState.cartProps = emu.cartProps
+	newState.cartPropsKnown = emu.cartPropsKnown
+}
 
-	return &newState, nil
+func (emu *emuState) hookCPU() {
+	emu.CPU.Write = emu.write
+	emu.CPU.Read = emu.read
+	emu.CPU.RunCycles = emu.runCycles
+	emu.CPU.Err = emu.cpuErr
 }
 
 var snapshotConverters = map[int]func(map[string]interface{}) error{
@@ -72,18 +108,117 @@ var snapshotConverters = map[int]func(map[string]interface{}) error{
 	// Converters should look like this (including comment):
 	// added 2017-XX-XX
 	// 1: convertSnap0To1,
+
+	// added 2026-10-18
+	1: convertSnap1To2,
+	// added 2026-10-18
+	2: convertSnap2To3,
+	// added 2026-10-18
+	3: convertSnap3To4,
+}
+
+func convertSnap1To2(state map[string]interface{}) error {
+	tia, ok := state["TIA"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("no TIA state found")
+	}
+	tia["DisplayStartLine"] = defaultDisplayStartLine
+	return nil
+}
+
+// sprite X went from a screen position to a position counter
+func convertSnap2To3(state map[string]interface{}) error {
+	tia, ok := state["TIA"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("no TIA state found")
+	}
+	screenX, ok := jsonInt(tia["ScreenX"])
+	if !ok {
+		return fmt.Errorf("no ScreenX found")
+	}
+	for _, name := range []string{"P0", "P1", "M0", "M1", "BL"} {
+		s, ok := tia[name].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("no %v state found", name)
+		}
+		x, ok := jsonInt(s["X"])
+		if !ok {
+			return fmt.Errorf("no %v.X found", name)
+		}
+		s["X"] = spritePosToCounter(screenX, x)
+	}
+	return nil
+}
+
+// sprite X went from counting from a copy's first pixel to
+// counting from its start signal
+func convertSnap3To4(state map[string]interface{}) error {
+	tia, ok := state["TIA"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("no TIA state found")
+	}
+	for _, name := range []string{"P0", "P1", "M0", "M1", "BL"} {
+		s, ok := tia[name].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("no %v state found", name)
+		}
+		x, ok := jsonInt(s["X"])
+		if !ok {
+			return fmt.Errorf("no %v.X found", name)
+		}
+		repeatMode, ok := jsonInt(s["RepeatMode"])
+		if !ok {
+			return fmt.Errorf("no %v.RepeatMode found", name)
+		}
+		s["X"] = startCountToScanCounter(name[0] == 'P', byte(repeatMode), byte(x))
+	}
+	return nil
+}
+
+// Old states are unpacked with UseNumber, so big ints like the
+// RNG state make it through, and converters put back plain ints.
+func jsonInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err == nil
+	case int:
+		return n, true
+	case byte:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// startCountToScanCounter converts a position counter from
+// before the graphics scan was added
+func startCountToScanCounter(isPlayer bool, repeatMode, x byte) byte {
+	startDelay := byte(missileStartDelay)
+	if isPlayer {
+		_, startDelay = playerScan(repeatMode)
+	}
+	return byte((int(x) + int(startDelay)) % 160)
+}
+
+func spritePosToCounter(screenX, x int) byte {
+	if screenX < 0 || screenX >= 160 {
+		screenX = 0
+	}
+	return byte((screenX - x + 2*160) % 160)
 }
 
 func (emu *emuState) convertOldSnapshot(snap *snapshot) (*emuState, error) {
 
 	var state map[string]interface{}
-	if err := json.Unmarshal(snap.State, &state); err != nil {
+	d := json.NewDecoder(bytes.NewReader(snap.State))
+	d.UseNumber()
+	if err := d.Decode(&state); err != nil {
 		return nil, fmt.Errorf("json unpack err: %v", err)
 	}
 
 	for i := snap.Version; i < currentSnapshotVersion; i++ {
-		if converterFn, ok := snapshotConverters[snap.Version]; !ok {
-			return nil, fmt.Errorf("unknown snapshot version: %v", snap.Version)
+		if converterFn, ok := snapshotConverters[i]; !ok {
+			return nil, fmt.Errorf("unknown snapshot version: %v", i)
 		} else if err := converterFn(state); err != nil {
 			return nil, fmt.Errorf("error converting snapshot version %v: %v", i, err)
 		}
@@ -98,24 +233,5 @@ func (emu *emuState) convertOldSnapshot(snap *snapshot) (*emuState, error) {
 }
 
 func (emu *emuState) makeSnapshot() []byte {
-	var err error
-	var emuJSON []byte
-	var snapJSON []byte
-	if emuJSON, err = json.Marshal(emu); err != nil {
-		panic(err)
-	}
-	snap := snapshot{
-		Version: currentSnapshotVersion,
-		Info:    infoString,
-		State:   json.RawMessage(emuJSON),
-		Mapper:  marshalMapper(emu.Mem.mapper),
-	}
-	if snapJSON, err = json.Marshal(&snap); err != nil {
-		panic(err)
-	}
-	buf := &bytes.Buffer{}
-	writer := gzip.NewWriter(buf)
-	writer.Write(snapJSON)
-	writer.Close()
-	return buf.Bytes()
+	return emu.makeBinSnapshot()
 }
@@ -0,0 +1,358 @@
+package vcsgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// Binary snapshots hold the same state as the JSON ones (every
+// exported field), minus derived data like the framebuffer (fields
+// tagged `snap:"-"`). They're written and read by walking the state
+// with reflect, which is a lot quicker than JSON and gzip.
+//
+// File format (ints are varints unless noted):
+//   "vcsgo bin snapshot\n", version
+//   emu state, mapper number, mapper state
+//
+// A struct is a field count, then per field its name and its
+// value, prefixed with the value's length (a 4 byte LE int).
+// Fields missing from a snapshot are left zero and unknown ones
+// are skipped, so adding or dropping a field needs no new version
+// (just like JSON). Changing a field's type or meaning does, along
+// with a converter.
+
+const binSnapshotMagic = "vcsgo bin snapshot\n"
+
+const currentBinSnapshotVersion = 3
+
+// Converters fix up a state decoded from an old version, which
+// has had any fields of the same name and type filled in.
+var binSnapshotConverters = map[int]func(*emuState) error{
+	// added 2026-10-18
+	1: convertBinSnap1To2,
+	// added 2026-10-18
+	2: convertBinSnap2To3,
+}
+
+func convertBinSnap1To2(state *emuState) error {
+	for _, s := range state.TIA.sprites() {
+		s.X = spritePosToCounter(state.TIA.ScreenX, int(s.X))
+	}
+	return nil
+}
+
+func convertBinSnap2To3(state *emuState) error {
+	for i, s := range state.TIA.sprites() {
+		s.X = startCountToScanCounter(i < 2, s.RepeatMode, s.X)
+	}
+	return nil
+}
+
+func (emu *emuState) makeBinSnapshot() []byte {
+	e := &binEncoder{}
+	e.buf = append(e.buf, binSnapshotMagic...)
+	e.uvarint(currentBinSnapshotVersion)
+	emu.encodeBinState(e)
+	return e.buf
+}
+
+func (emu *emuState) loadBinSnapshot(snapBytes []byte) (*emuState, error) {
+	d := &binDecoder{buf: snapBytes[len(binSnapshotMagic):]}
+	version := d.uvarint()
+	if d.err != nil {
+		return nil, d.err
+	} else if version > currentBinSnapshotVersion {
+		return nil, fmt.Errorf("this version of vcsgo is too old to open this snapshot")
+	}
+	newState, err := decodeBinState(d)
+	if err != nil {
+		return nil, err
+	}
+	for i := int(version); i < currentBinSnapshotVersion; i++ {
+		if converterFn, ok := binSnapshotConverters[i]; !ok {
+			return nil, fmt.Errorf("unknown snapshot version: %v", i)
+		} else if err := converterFn(newState); err != nil {
+			return nil, fmt.Errorf("error converting snapshot version %v: %v", i, err)
+		}
+	}
+	return emu.loadedState(newState), nil
+}
+
+// encodeBinState writes the state without any header, for
+// snapshots and rewind.
+func (emu *emuState) encodeBinState(e *binEncoder) {
+	e.value(reflect.ValueOf(emu).Elem())
+	e.uvarint(uint64(emu.Mem.mapper.getMapperNum()))
+	e.value(reflect.ValueOf(emu.Mem.mapper).Elem())
+	if e.err != nil {
+		panic(e.err)
+	}
+}
+
+func decodeBinState(d *binDecoder) (*emuState, error) {
+	var newState emuState
+	d.value(reflect.ValueOf(&newState).Elem())
+	mapperNum := d.uvarint()
+	if d.err != nil {
+		return nil, fmt.Errorf("snapshot state: %v", d.err)
+	}
+	mapper, err := newMapperFromNum(uint16(mapperNum))
+	if err != nil {
+		return nil, err
+	}
+	d.value(reflect.ValueOf(mapper).Elem())
+	if d.err != nil {
+		return nil, fmt.Errorf("snapshot mapper state: %v", d.err)
+	}
+	newState.Mem.mapper = mapper
+	return &newState, nil
+}
+
+var byteType = reflect.TypeOf(byte(0))
+
+type binField struct {
+	index int
+	name  string
+}
+
+var binFieldCache sync.Map // reflect.Type -> []binField
+
+// binFields lists the fields of a struct type that get marshalled
+func binFields(t reflect.Type) []binField {
+	if fields, ok := binFieldCache.Load(t); ok {
+		return fields.([]binField)
+	}
+	fields := []binField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("snap") == "-" || f.Tag.Get("json") == "-" {
+			continue
+		}
+		if k := f.Type.Kind(); k == reflect.Func || k == reflect.Chan {
+			continue
+		}
+		fields = append(fields, binField{index: i, name: f.Name})
+	}
+	binFieldCache.Store(t, fields)
+	return fields
+}
+
+type binEncoder struct {
+	buf []byte
+	err error
+}
+
+func (e *binEncoder) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func (e *binEncoder) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutVarint(b[:], v)]...)
+}
+
+func (e *binEncoder) value(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 1)
+		} else {
+			e.buf = append(e.buf, 0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.varint(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.uvarint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(v.Float()))
+		e.buf = append(e.buf, b[:]...)
+	case reflect.String:
+		e.uvarint(uint64(v.Len()))
+		e.buf = append(e.buf, v.String()...)
+	case reflect.Array, reflect.Slice:
+		e.uvarint(uint64(v.Len()))
+		if v.Type().Elem() == byteType {
+			start := len(e.buf)
+			e.buf = append(e.buf, make([]byte, v.Len())...)
+			reflect.Copy(reflect.ValueOf(e.buf[start:]), v)
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			e.value(v.Index(i))
+		}
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0)
+		} else {
+			e.buf = append(e.buf, 1)
+			e.value(v.Elem())
+		}
+	case reflect.Struct:
+		fields := binFields(v.Type())
+		e.uvarint(uint64(len(fields)))
+		for _, f := range fields {
+			e.uvarint(uint64(len(f.name)))
+			e.buf = append(e.buf, f.name...)
+			lenPos := len(e.buf)
+			e.buf = append(e.buf, 0, 0, 0, 0)
+			e.value(v.Field(f.index))
+			binary.LittleEndian.PutUint32(e.buf[lenPos:], uint32(len(e.buf)-lenPos-4))
+		}
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("can't marshal %v", v.Type())
+		}
+	}
+}
+
+type binDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *binDecoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, args...)
+	}
+	d.buf = nil
+}
+
+func (d *binDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail("bad uvarint")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *binDecoder) varint() int64 {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail("bad varint")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *binDecoder) bytes(n uint64) []byte {
+	if n > uint64(len(d.buf)) {
+		d.fail("cut short")
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+// length reads a length, which can't be more than the bytes
+// left, as everything takes at least a byte
+func (d *binDecoder) length() int {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.fail("bad length %v", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *binDecoder) value(v reflect.Value) {
+	if d.err != nil {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if b := d.bytes(1); b != nil {
+			v.SetBool(b[0] != 0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(d.varint())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(d.uvarint())
+	case reflect.Float32, reflect.Float64:
+		if b := d.bytes(8); b != nil {
+			v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+		}
+	case reflect.String:
+		v.SetString(string(d.bytes(uint64(d.length()))))
+	case reflect.Array, reflect.Slice:
+		n := d.length()
+		if v.Kind() == reflect.Slice {
+			if n == 0 {
+				v.Set(reflect.Zero(v.Type()))
+				return
+			}
+			v.Set(reflect.MakeSlice(v.Type(), n, n))
+		} else if n != v.Len() {
+			d.fail("%v has %v elements, not %v", v.Type(), v.Len(), n)
+			return
+		}
+		if v.Type().Elem() == byteType {
+			reflect.Copy(v, reflect.ValueOf(d.bytes(uint64(n))))
+			return
+		}
+		for i := 0; i < n; i++ {
+			d.value(v.Index(i))
+		}
+	case reflect.Ptr:
+		if b := d.bytes(1); b == nil || b[0] == 0 {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.New(v.Type().Elem()))
+			d.value(v.Elem())
+		}
+	case reflect.Interface:
+		// like JSON, this only works if the interface
+		// already holds a pointer to unmarshal into
+		if b := d.bytes(1); b == nil || b[0] == 0 {
+			v.Set(reflect.Zero(v.Type()))
+		} else if v.IsNil() || v.Elem().Kind() != reflect.Ptr || v.Elem().IsNil() {
+			d.fail("can't unmarshal into empty %v", v.Type())
+		} else if b := d.bytes(1); b == nil || b[0] == 0 {
+			d.fail("can't unmarshal nil into %v", v.Type())
+		} else {
+			d.value(v.Elem().Elem())
+		}
+	case reflect.Struct:
+		fields := binFields(v.Type())
+		numFields := d.length()
+		for i := 0; i < numFields && d.err == nil; i++ {
+			name := d.bytes(uint64(d.length()))
+			lenBytes := d.bytes(4)
+			if lenBytes == nil {
+				return
+			}
+			data := d.bytes(uint64(binary.LittleEndian.Uint32(lenBytes)))
+			if d.err != nil {
+				return
+			}
+			for _, f := range fields {
+				if f.name == string(name) {
+					fd := &binDecoder{buf: data}
+					fd.value(v.Field(f.index))
+					if fd.err == nil && len(fd.buf) != 0 {
+						fd.fail("extra bytes")
+					}
+					if fd.err != nil {
+						d.fail("%v: %v", f.name, fd.err)
+					}
+					break
+				}
+			}
+		}
+	default:
+		d.fail("can't unmarshal %v", v.Type())
+	}
+}
+
+func isBinSnapshot(snapBytes []byte) bool {
+	return bytes.HasPrefix(snapBytes, []byte(binSnapshotMagic))
+}
@@ -0,0 +1,287 @@
+package vcsgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// snapTestState is a state with some of everything going: sprites
+// on screen, RAM in use, the RNG and undriven bits, and a step
+// count that leaves it mid-line.
+func snapTestState(t *testing.T) *emuState {
+	return snapTestStateNUSIZ(t, 0x31, 0x00)
+}
+
+func snapTestStateNUSIZ(t *testing.T, nusiz0, nusiz1 byte) *emuState {
+	rom := testKernel(func(a *asm) {
+		a.lda(0xa5)
+		a.sta(0x1b) // GRP0
+		a.sta(0x1c) // GRP1
+		a.lda(nusiz1)
+		a.sta(0x05) // NUSIZ1
+		a.lda(nusiz0)
+		a.sta(0x04) // NUSIZ0
+		a.lda(2)
+		a.sta(0x1d) // ENAM0
+		a.lda(0x20)
+		a.sta(0x0a) // CTRLPF
+		a.sta(0x1f) // ENABL
+		a.wsync()
+		a.nops(17)
+		a.sta(0x10)      // RESP0
+		a.sta(0x11)      // RESP1
+		a.sta(0x12)      // RESM0
+		a.sta(0x14)      // RESBL
+		a.op(0x65, 0x0c) // ADC INPT4
+		a.sta(0x81)
+	}, func(a *asm) {})
+	emu := runTestFrames(t, rom, Options{Seed: 9, RandomizeUndrivenTIABits: true}, 3)
+	for i := 0; i < 1234; i++ {
+		emu.Step()
+	}
+	return emu
+}
+
+// stateJSON is a state as the JSON snapshots have it, for
+// comparing states
+func stateJSON(t *testing.T, emu *emuState) string {
+	if len(emu.TIA.PendingWrites) == 0 {
+		emu.TIA.PendingWrites = nil
+	}
+	state, err := json.Marshal(emu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapper, err := json.Marshal(emu.Mem.mapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(state) + string(mapper)
+}
+
+// checkSnapLoad checks that a loaded state matches the one it
+// was saved from, and stays matched as it runs.
+func checkSnapLoad(t *testing.T, name string, emu, loaded *emuState) {
+	t.Helper()
+	if stateJSON(t, loaded) != stateJSON(t, emu) {
+		t.Errorf("%v: loaded state differs", name)
+		return
+	}
+	emu = emu.clone(t)
+	for f := 0; f < 2; f++ {
+		for !emu.FlipRequested() {
+			emu.Step()
+		}
+		for !loaded.FlipRequested() {
+			loaded.Step()
+		}
+	}
+	if loaded.Cycles != emu.Cycles || loaded.Mem.RAM != emu.Mem.RAM || loaded.TIA.Screen != emu.TIA.Screen {
+		t.Errorf("%v: loaded state ran differently", name)
+	}
+}
+
+func (emu *emuState) clone(t *testing.T) *emuState {
+	c, err := emu.loadBinSnapshot(emu.makeBinSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestBinSnapshotRoundTrip(t *testing.T) {
+	emu := snapTestState(t)
+	snap := emu.makeSnapshot()
+	if !isBinSnapshot(snap) {
+		t.Fatal("snapshots aren't binary")
+	}
+	loaded, err := emu.loadSnapshot(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSnapLoad(t, "binary", emu, loaded)
+}
+
+func TestBinSnapshotMapperStates(t *testing.T) {
+	for _, mn := range mapperNames {
+		m := mn.make(make([]byte, 32*1024))
+		// dirty the state a bit
+		v := reflect.ValueOf(m).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			if name := v.Type().Field(i).Name; name == "MapperNum" || name == "Num" {
+				continue
+			}
+			switch f := v.Field(i); f.Kind() {
+			case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				f.SetUint(3)
+			case reflect.Int, reflect.Int32, reflect.Int64:
+				if v.Type().Field(i).Name != "Version" {
+					f.SetInt(-5)
+				}
+			case reflect.Bool:
+				f.SetBool(true)
+			}
+		}
+		e := &binEncoder{}
+		e.value(v)
+		if e.err != nil {
+			t.Fatalf("%v: %v", mn.name, e.err)
+		}
+		m2, err := newMapperFromNum(m.getMapperNum())
+		if err != nil {
+			t.Fatalf("%v: %v", mn.name, err)
+		}
+		d := &binDecoder{buf: e.buf}
+		d.value(reflect.ValueOf(m2).Elem())
+		if d.err != nil || len(d.buf) != 0 {
+			t.Fatalf("%v: %v, %d bytes left", mn.name, d.err, len(d.buf))
+		}
+		j1, _ := json.Marshal(m)
+		j2, _ := json.Marshal(m2)
+		if !bytes.Equal(j1, j2) {
+			t.Errorf("%v: mapper state differs after a round trip", mn.name)
+		}
+	}
+}
+
+func TestBinSnapshotErrors(t *testing.T) {
+	emu := snapTestState(t)
+	snap := emu.makeSnapshot()
+	newer := append([]byte(binSnapshotMagic), byte(currentBinSnapshotVersion+1))
+	newer = append(newer, snap[len(binSnapshotMagic)+1:]...)
+	for _, c := range []struct {
+		name string
+		snap []byte
+		want string
+	}{
+		{"truncated", snap[:len(snap)-7], "snapshot"},
+		{"newer version", newer, "too old"},
+		{"garbage", []byte("not a snapshot at all"), "gzip"},
+	} {
+		_, err := emu.loadSnapshot(c.snap)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%v: got %v, want an error containing %q", c.name, err, c.want)
+		}
+	}
+}
+
+// jsonSnapshot makes the gzipped JSON snapshot an older vcsgo
+// would have, with the state changed to match its version.
+func jsonSnapshot(t *testing.T, emu *emuState, version int, toOld func(state map[string]interface{})) []byte {
+	state := map[string]interface{}{}
+	d := json.NewDecoder(strings.NewReader(stateJSONOnly(t, emu)))
+	d.UseNumber()
+	if err := d.Decode(&state); err != nil {
+		t.Fatal(err)
+	}
+	toOld(state)
+	stateBytes, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapJSON, err := json.Marshal(&snapshot{
+		Version: version,
+		Info:    infoString,
+		State:   stateBytes,
+		Mapper:  marshalMapper(emu.Mem.mapper),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	w.Write(snapJSON)
+	w.Close()
+	return buf.Bytes()
+}
+
+func stateJSONOnly(t *testing.T, emu *emuState) string {
+	state, err := json.Marshal(emu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(state)
+}
+
+// JSON snapshots are still loaded, and old ones are converted
+// up through every version to the same state.
+func TestJSONSnapshotVersions(t *testing.T) {
+	for _, st := range []struct {
+		name           string
+		nusiz0, nusiz1 byte
+	}{
+		{"", 0x31, 0x00},
+		// wide players start a clock later
+		{"wide players, ", 0x37, 0x05},
+	} {
+		emu := snapTestStateNUSIZ(t, st.nusiz0, st.nusiz1)
+		checkJSONSnapshotVersions(t, st.name, emu)
+	}
+
+	emu := snapTestState(t)
+	_, err := emu.loadSnapshot(jsonSnapshot(t, emu, currentSnapshotVersion+1, func(map[string]interface{}) {}))
+	if err == nil || !strings.Contains(err.Error(), "too old") {
+		t.Errorf("newer json snapshot: got %v, want a too old error", err)
+	}
+}
+
+func checkJSONSnapshotVersions(t *testing.T, name string, emu *emuState) {
+	spriteXs := func(state map[string]interface{}, fn func(name string, x int, repeatMode byte) int) {
+		tia := state["TIA"].(map[string]interface{})
+		for _, name := range []string{"P0", "P1", "M0", "M1", "BL"} {
+			s := tia[name].(map[string]interface{})
+			x, _ := s["X"].(json.Number).Int64()
+			repeatMode, _ := s["RepeatMode"].(json.Number).Int64()
+			s["X"] = json.Number(strconv.Itoa(fn(name, int(x), byte(repeatMode))))
+		}
+	}
+	// undo each version's change to the sprite counters
+	to3 := func(state map[string]interface{}) {
+		spriteXs(state, func(name string, x int, repeatMode byte) int {
+			delay := byte(missileStartDelay)
+			if name[0] == 'P' {
+				_, delay = playerScan(repeatMode)
+			}
+			return (x - int(delay) + 160) % 160
+		})
+	}
+	to2 := func(state map[string]interface{}) {
+		to3(state)
+		screenX := emu.TIA.ScreenX
+		if screenX < 0 || screenX >= 160 {
+			screenX = 0
+		}
+		spriteXs(state, func(name string, x int, repeatMode byte) int {
+			return (screenX - x + 2*160) % 160
+		})
+	}
+	to1 := func(state map[string]interface{}) {
+		to2(state)
+		delete(state["TIA"].(map[string]interface{}), "DisplayStartLine")
+	}
+
+	if emu.TIA.DisplayStartLine != defaultDisplayStartLine {
+		t.Fatalf("test state has a DisplayStartLine v1 can't have")
+	}
+	for _, c := range []struct {
+		version int
+		toOld   func(map[string]interface{})
+	}{
+		{4, func(map[string]interface{}) {}},
+		{3, to3},
+		{2, to2},
+		{1, to1},
+	} {
+		loaded, err := emu.loadSnapshot(jsonSnapshot(t, emu, c.version, c.toOld))
+		if err != nil {
+			t.Errorf("%vjson v%v: %v", name, c.version, err)
+			continue
+		}
+		checkSnapLoad(t, name+"json v"+strconv.Itoa(c.version), emu, loaded)
+	}
+}
@@ -0,0 +1,567 @@
+package vcsgo
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// thumbCPU is enough of an ARM7TDMI in thumb mode to run the
+// C code that Harmony/Melody carts (DPC+, CDF, CDFJ) call into.
+// Memory is laid out like the LPC2103 on those carts, flash at
+// 0x00000000 and SRAM at 0x40000000. Peripherals are ignored.
+//
+// A call runs until the code branches to an ARM mode (even)
+// address, which is how it hands control back to the driver.
+
+const (
+	thumbRAMBase = 0x40000000
+
+	// the LPC2103 on the Harmony runs at 70MHz
+	thumbClocksPerSecond = 70000000
+
+	// much more than a frame's worth, to catch runaway code
+	thumbMaxInstructions = 2000000
+)
+
+type thumbCPU struct {
+	R [16]uint32
+
+	N, Z, C, V bool
+
+	Cycles uint64
+
+	rom []byte
+	ram []byte
+
+	// driverCall lets the cart handle calls into its ARM mode
+	// driver routines. It returns false for the final return.
+	driverCall func(c *thumbCPU, addr uint32) bool
+
+	done bool
+}
+
+func newThumbCPU(rom, ram []byte, entry, returnAddr uint32) *thumbCPU {
+	c := &thumbCPU{rom: rom, ram: ram}
+	c.R[13] = thumbRAMBase + uint32(len(ram)) - 0x4c
+	c.R[14] = returnAddr
+	c.R[15] = entry
+	return c
+}
+
+func (c *thumbCPU) run() error {
+	for i := 0; i < thumbMaxInstructions; i++ {
+		if err := c.step(); err != nil {
+			return err
+		}
+		if c.done {
+			return nil
+		}
+	}
+	return fmt.Errorf("thumb: gave up after %d instructions at 0x%08x", thumbMaxInstructions, c.R[15])
+}
+
+// cpuCycles returns how long the call kept the 6507 waiting.
+// NOTE: PAL's CPU clock is within 1% of NTSC's, so just use NTSC.
+func (c *thumbCPU) cpuCycles() uint {
+	return uint(float64(c.Cycles) * (ntscClocksPerSecond / 3) / thumbClocksPerSecond)
+}
+
+func (c *thumbCPU) memSlice(addr uint32) []byte {
+	if addr < uint32(len(c.rom)) {
+		return c.rom[addr:]
+	}
+	if addr >= thumbRAMBase && addr-thumbRAMBase < uint32(len(c.ram)) {
+		return c.ram[addr-thumbRAMBase:]
+	}
+	return nil
+}
+
+func (c *thumbCPU) read(addr uint32, size uint32) uint32 {
+	addr &^= size - 1
+	b := c.memSlice(addr)
+	if uint32(len(b)) < size {
+		return 0
+	}
+	switch size {
+	case 1:
+		return uint32(b[0])
+	case 2:
+		return uint32(binary.LittleEndian.Uint16(b))
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (c *thumbCPU) write(addr uint32, val uint32, size uint32) {
+	addr &^= size - 1
+	if addr < thumbRAMBase || addr-thumbRAMBase+size > uint32(len(c.ram)) {
+		return // flash and peripherals
+	}
+	b := c.ram[addr-thumbRAMBase:]
+	switch size {
+	case 1:
+		b[0] = byte(val)
+	case 2:
+		binary.LittleEndian.PutUint16(b, uint16(val))
+	default:
+		binary.LittleEndian.PutUint32(b, val)
+	}
+}
+
+func (c *thumbCPU) setNZ(val uint32) {
+	c.N = val>>31 != 0
+	c.Z = val == 0
+}
+
+func (c *thumbCPU) addWithFlags(a, b, carry uint32) uint32 {
+	sum := uint64(a) + uint64(b) + uint64(carry)
+	result := uint32(sum)
+	c.setNZ(result)
+	c.C = sum>>32 != 0
+	c.V = (^(a^b)&(a^result))>>31 != 0
+	return result
+}
+
+func (c *thumbCPU) subWithFlags(a, b, carry uint32) uint32 {
+	return c.addWithFlags(a, ^b, carry)
+}
+
+func (c *thumbCPU) carryBit() uint32 {
+	if c.C {
+		return 1
+	}
+	return 0
+}
+
+func (c *thumbCPU) lsl(val, n uint32) uint32 {
+	switch {
+	case n == 0:
+		return val
+	case n < 32:
+		c.C = val>>(32-n)&1 != 0
+		return val << n
+	case n == 32:
+		c.C = val&1 != 0
+	default:
+		c.C = false
+	}
+	return 0
+}
+
+func (c *thumbCPU) lsr(val, n uint32) uint32 {
+	switch {
+	case n == 0:
+		return val
+	case n < 32:
+		c.C = val>>(n-1)&1 != 0
+		return val >> n
+	case n == 32:
+		c.C = val>>31 != 0
+	default:
+		c.C = false
+	}
+	return 0
+}
+
+func (c *thumbCPU) asr(val, n uint32) uint32 {
+	switch {
+	case n == 0:
+		return val
+	case n < 32:
+		c.C = val>>(n-1)&1 != 0
+		return uint32(int32(val) >> n)
+	}
+	c.C = val>>31 != 0
+	return uint32(int32(val) >> 31)
+}
+
+func (c *thumbCPU) ror(val, n uint32) uint32 {
+	if n == 0 {
+		return val
+	}
+	if n &= 31; n == 0 {
+		c.C = val>>31 != 0
+		return val
+	}
+	result := val>>n | val<<(32-n)
+	c.C = result>>31 != 0
+	return result
+}
+
+func (c *thumbCPU) condPassed(cond uint32) bool {
+	switch cond {
+	case 0x0:
+		return c.Z
+	case 0x1:
+		return !c.Z
+	case 0x2:
+		return c.C
+	case 0x3:
+		return !c.C
+	case 0x4:
+		return c.N
+	case 0x5:
+		return !c.N
+	case 0x6:
+		return c.V
+	case 0x7:
+		return !c.V
+	case 0x8:
+		return c.C && !c.Z
+	case 0x9:
+		return !c.C || c.Z
+	case 0xa:
+		return c.N == c.V
+	case 0xb:
+		return c.N != c.V
+	case 0xc:
+		return !c.Z && c.N == c.V
+	case 0xd:
+		return c.Z || c.N != c.V
+	}
+	return true
+}
+
+// branchExchange is BX, where an even addr means ARM mode,
+// i.e. a call into the driver or the end of the call.
+func (c *thumbCPU) branchExchange(addr uint32) {
+	c.Cycles += 2
+	if addr&1 == 0 {
+		if c.driverCall != nil && c.driverCall(c, addr) {
+			c.R[15] = c.R[14] &^ 1
+			return
+		}
+		c.done = true
+	}
+	c.R[15] = addr &^ 1
+}
+
+func signExtend(val uint32, bits uint) uint32 {
+	shift := 32 - bits
+	return uint32(int32(val<<shift) >> shift)
+}
+
+func (c *thumbCPU) step() error {
+	addr := c.R[15]
+	inst := c.read(addr, 2)
+	c.R[15] = addr + 2
+	pc := addr + 4 // what the instruction sees as PC
+	c.Cycles++
+
+	lo3 := func(shift uint) uint32 { return inst >> shift & 7 }
+
+	switch {
+
+	case inst>>13 == 0 && inst>>11 != 3: // shift by immediate
+		rd, rs, n := lo3(0), lo3(3), inst>>6&0x1f
+		var result uint32
+		switch inst >> 11 {
+		case 0:
+			result = c.lsl(c.R[rs], n)
+		case 1:
+			if n == 0 {
+				n = 32
+			}
+			result = c.lsr(c.R[rs], n)
+		case 2:
+			if n == 0 {
+				n = 32
+			}
+			result = c.asr(c.R[rs], n)
+		}
+		c.R[rd] = result
+		c.setNZ(result)
+
+	case inst>>11 == 3: // add/sub register or 3 bit immediate
+		rd, rs := lo3(0), lo3(3)
+		operand := lo3(6)
+		if inst&0x400 == 0 {
+			operand = c.R[operand]
+		}
+		if inst&0x200 == 0 {
+			c.R[rd] = c.addWithFlags(c.R[rs], operand, 0)
+		} else {
+			c.R[rd] = c.subWithFlags(c.R[rs], operand, 1)
+		}
+
+	case inst>>13 == 1: // mov/cmp/add/sub 8 bit immediate
+		rd, imm := lo3(8), inst&0xff
+		switch inst >> 11 & 3 {
+		case 0:
+			c.R[rd] = imm
+			c.setNZ(imm)
+		case 1:
+			c.subWithFlags(c.R[rd], imm, 1)
+		case 2:
+			c.R[rd] = c.addWithFlags(c.R[rd], imm, 0)
+		case 3:
+			c.R[rd] = c.subWithFlags(c.R[rd], imm, 1)
+		}
+
+	case inst>>10 == 0x10: // ALU ops
+		rd, rs := lo3(0), lo3(3)
+		a, b := c.R[rd], c.R[rs]
+		var result uint32
+		writeBack := true
+		switch inst >> 6 & 0xf {
+		case 0x0:
+			result = a & b
+		case 0x1:
+			result = a ^ b
+		case 0x2:
+			result = c.lsl(a, b&0xff)
+			c.Cycles++
+		case 0x3:
+			result = c.lsr(a, b&0xff)
+			c.Cycles++
+		case 0x4:
+			result = c.asr(a, b&0xff)
+			c.Cycles++
+		case 0x5:
+			result = c.addWithFlags(a, b, c.carryBit())
+		case 0x6:
+			result = c.subWithFlags(a, b, c.carryBit())
+		case 0x7:
+			result = c.ror(a, b&0xff)
+			c.Cycles++
+		case 0x8:
+			result = a & b
+			writeBack = false
+		case 0x9:
+			result = c.subWithFlags(0, b, 1)
+		case 0xa:
+			result = c.subWithFlags(a, b, 1)
+			writeBack = false
+		case 0xb:
+			result = c.addWithFlags(a, b, 0)
+			writeBack = false
+		case 0xc:
+			result = a | b
+		case 0xd:
+			result = a * b
+			c.Cycles += 3
+		case 0xe:
+			result = a &^ b
+		case 0xf:
+			result = ^b
+		}
+		c.setNZ(result)
+		if writeBack {
+			c.R[rd] = result
+		}
+
+	case inst>>10 == 0x11: // hi register ops / BX
+		rd := lo3(0) | inst>>4&8
+		rs := lo3(3) | inst>>3&8
+		src := c.R[rs]
+		if rs == 15 {
+			src = pc
+		}
+		dst := c.R[rd]
+		if rd == 15 {
+			dst = pc
+		}
+		switch inst >> 8 & 3 {
+		case 0:
+			c.setReg(rd, dst+src)
+		case 1:
+			c.subWithFlags(dst, src, 1)
+		case 2:
+			c.setReg(rd, src)
+		case 3:
+			c.branchExchange(src)
+		}
+
+	case inst>>11 == 0x09: // PC relative load
+		c.R[lo3(8)] = c.read((pc&^2)+(inst&0xff)*4, 4)
+		c.Cycles += 2
+
+	case inst>>12 == 0x5: // load/store with register offset
+		rd := lo3(0)
+		target := c.R[lo3(3)] + c.R[lo3(6)]
+		switch inst >> 9 & 7 {
+		case 0:
+			c.write(target, c.R[rd], 4)
+		case 1:
+			c.write(target, c.R[rd], 2)
+		case 2:
+			c.write(target, c.R[rd], 1)
+		case 3:
+			c.R[rd] = signExtend(c.read(target, 1), 8)
+		case 4:
+			c.R[rd] = c.read(target, 4)
+		case 5:
+			c.R[rd] = c.read(target, 2)
+		case 6:
+			c.R[rd] = c.read(target, 1)
+		case 7:
+			c.R[rd] = signExtend(c.read(target, 2), 16)
+		}
+		c.addLoadStoreCycles(inst&0x0800 != 0 || inst>>9&7 == 3)
+
+	case inst>>13 == 0x3: // load/store with immediate offset
+		rd, rb, off := lo3(0), lo3(3), inst>>6&0x1f
+		size := uint32(1)
+		if inst&0x1000 == 0 {
+			size = 4
+		}
+		target := c.R[rb] + off*size
+		load := inst&0x0800 != 0
+		if load {
+			c.R[rd] = c.read(target, size)
+		} else {
+			c.write(target, c.R[rd], size)
+		}
+		c.addLoadStoreCycles(load)
+
+	case inst>>12 == 0x8: // load/store halfword
+		rd, rb, off := lo3(0), lo3(3), inst>>6&0x1f
+		target := c.R[rb] + off*2
+		load := inst&0x0800 != 0
+		if load {
+			c.R[rd] = c.read(target, 2)
+		} else {
+			c.write(target, c.R[rd], 2)
+		}
+		c.addLoadStoreCycles(load)
+
+	case inst>>12 == 0x9: // SP relative load/store
+		rd := lo3(8)
+		target := c.R[13] + (inst&0xff)*4
+		load := inst&0x0800 != 0
+		if load {
+			c.R[rd] = c.read(target, 4)
+		} else {
+			c.write(target, c.R[rd], 4)
+		}
+		c.addLoadStoreCycles(load)
+
+	case inst>>12 == 0xa: // load address
+		base := pc &^ 2
+		if inst&0x0800 != 0 {
+			base = c.R[13]
+		}
+		c.R[lo3(8)] = base + (inst&0xff)*4
+
+	case inst>>8 == 0xb0: // add offset to SP
+		off := (inst & 0x7f) * 4
+		if inst&0x80 != 0 {
+			c.R[13] -= off
+		} else {
+			c.R[13] += off
+		}
+
+	case inst>>12 == 0xb && inst>>9&3 == 2: // push/pop
+		rlist := inst & 0xff
+		if inst&0x0800 == 0 {
+			if inst&0x100 != 0 {
+				rlist |= 1 << 14
+			}
+			sp := c.R[13] - 4*uint32(popCount16(rlist))
+			c.R[13] = sp
+			c.storeMultiple(sp, rlist)
+		} else {
+			if inst&0x100 != 0 {
+				rlist |= 1 << 15
+			}
+			c.R[13] = c.loadMultiple(c.R[13], rlist)
+		}
+
+	case inst>>12 == 0xc: // load/store multiple
+		rb := lo3(8)
+		rlist := inst & 0xff
+		if inst&0x0800 == 0 {
+			c.storeMultiple(c.R[rb], rlist)
+			c.R[rb] += 4 * uint32(popCount16(rlist))
+		} else {
+			end := c.loadMultiple(c.R[rb], rlist)
+			if rlist&(1<<rb) == 0 {
+				c.R[rb] = end
+			}
+		}
+
+	case inst>>8 == 0xdf: // SWI
+		return fmt.Errorf("thumb: unhandled SWI 0x%02x at 0x%08x", inst&0xff, addr)
+
+	case inst>>12 == 0xd: // conditional branch
+		cond := inst >> 8 & 0xf
+		if cond == 0xe {
+			return fmt.Errorf("thumb: undefined instruction 0x%04x at 0x%08x", inst, addr)
+		}
+		if c.condPassed(cond) {
+			c.R[15] = pc + signExtend(inst&0xff, 8)*2
+			c.Cycles += 2
+		}
+
+	case inst>>11 == 0x1c: // unconditional branch
+		c.R[15] = pc + signExtend(inst&0x7ff, 11)*2
+		c.Cycles += 2
+
+	case inst>>11 == 0x1e: // long branch with link, high half
+		c.R[14] = pc + signExtend(inst&0x7ff, 11)<<12
+
+	case inst>>11 == 0x1f: // long branch with link, low half
+		next := addr + 2
+		c.R[15] = c.R[14] + (inst&0x7ff)<<1
+		c.R[14] = next | 1
+		c.Cycles += 2
+
+	default:
+		return fmt.Errorf("thumb: undefined instruction 0x%04x at 0x%08x", inst, addr)
+	}
+
+	return nil
+}
+
+func (c *thumbCPU) setReg(r uint32, val uint32) {
+	if r == 15 {
+		c.R[15] = val &^ 1
+		c.Cycles += 2
+	} else {
+		c.R[r] = val
+	}
+}
+
+func (c *thumbCPU) addLoadStoreCycles(load bool) {
+	if load {
+		c.Cycles += 2
+	} else {
+		c.Cycles++
+	}
+}
+
+func (c *thumbCPU) storeMultiple(addr uint32, rlist uint32) {
+	for r := uint32(0); r < 16; r++ {
+		if rlist&(1<<r) != 0 {
+			c.write(addr, c.R[r], 4)
+			addr += 4
+			c.Cycles++
+		}
+	}
+}
+
+// loadMultiple returns the addr after the last word loaded.
+// Like BX, popping an even addr into PC ends the call.
+func (c *thumbCPU) loadMultiple(addr uint32, rlist uint32) uint32 {
+	for r := uint32(0); r < 16; r++ {
+		if rlist&(1<<r) != 0 {
+			val := c.read(addr, 4)
+			if r == 15 {
+				c.branchExchange(val)
+			} else {
+				c.R[r] = val
+			}
+			addr += 4
+			c.Cycles++
+		}
+	}
+	c.Cycles++
+	return addr
+}
+
+func popCount16(val uint32) int {
+	count := 0
+	for ; val != 0; val &= val - 1 {
+		count++
+	}
+	return count
+}
@@ -3,7 +3,7 @@ package vcsgo
 import "fmt"
 
 type tia struct {
-	Screen [320 * 264 * 4]byte
+	Screen [320 * 264 * 4]byte `snap:"-"`
 
 	Palette [128][3]byte
 
@@ -18,6 +18,9 @@ type tia struct {
 	ScreenX int
 	ScreenY int
 
+	// scanlines after VSYNC before the top of the screen
+	DisplayStartLine int
+
 	Collisions collisions
 
 	P0, P1 sprite
@@ -27,8 +30,25 @@ type tia struct {
 	HideM0 bool
 	HideM1 bool
 
-	HMoveRequested   bool
-	HMoveCombEnabled bool
+	// HMOVE sends extra clocks to each object's position counter,
+	// one every four color clocks. HMoveClock counts them, and an
+	// object stops getting them once it matches that object's Vx.
+	HMoveActive bool
+	HMoveClock  byte
+
+	// HMoveLatch is set by HMOVE and cleared when a line starts.
+	// If it's set when HBLANK would end, HBLANK runs 8 clocks
+	// longer (ExtendedHBlank), and objects miss those 8 clocks.
+	// Those 8 pixels are black, making the "comb" down the left
+	// edge of lines that HMOVE. HMOVE strobed after HBLANK has
+	// ended has no comb, on this line or the next.
+	HMoveLatch     bool
+	ExtendedHBlank bool
+
+	// hideHMoveComb draws the comb's pixels as playfield
+	// and background instead, for a cleaner edge. A session
+	// setting, not kept in snapshots.
+	hideHMoveComb bool
 
 	// loaded in such that a screen half is Bits 19-0
 	Playfield               uint32
@@ -56,12 +76,38 @@ type tia struct {
 	WasInVBlank bool
 
 	ShowDebugPuck bool
+
+	// writes waiting to take effect, oldest first
+	PendingWrites []tiaWrite
+
+	log *logSink
+}
+
+type tiaWrite struct {
+	Addr  byte
+	Val   byte
+	Delay byte
 }
 
 type sprite struct {
+	// X is the object's position counter, which runs 0-159 and
+	// is clocked every visible pixel (plus any HMOVE clocks).
+	// RESxx resets it, and a copy starts when it's clocked round
+	// to 0, or to 16, 32 or 64 if NUSIZ has a copy there.
 	X  byte
 	Vx int8
 
+	// still getting HMOVE clocks
+	Moving bool
+
+	// The graphics scan. A start sets StartDelay, and when it runs
+	// out the object's pixels are scanned out, one per clock (or
+	// per ScanSub wrap, on wide players), with ScanBit counting.
+	StartDelay byte
+	Scanning   bool
+	ScanBit    byte
+	ScanSub    byte
+
 	ColorLuma byte
 
 	// only for P0/P1
@@ -80,6 +126,154 @@ type sprite struct {
 	LatchedShow bool
 }
 
+// A write lands at the end of the CPU cycle that makes it, which
+// is 3 color clocks after the CPU makes it here (so a STA COLUBK
+// ending on cycle C of a line changes color from pixel 3*C-68 on).
+// Some registers then take a few more clocks to take effect.
+const tiaWriteCycleClocks = 3
+
+// extra color clocks before a write to each register takes effect
+var tiaWriteDelays = [0x40]byte{
+	0x01: 1, // VBLANK
+	0x0b: 1, // REFP0
+	0x0c: 1, // REFP1
+	0x0d: 2, // PF0
+	0x0e: 2, // PF1
+	0x0f: 2, // PF2
+	0x1b: 1, // GRP0
+	0x1c: 1, // GRP1
+	0x1d: 1, // ENAM0
+	0x1e: 1, // ENAM1
+	0x1f: 1, // ENABL
+	0x20: 2, // HMP0
+	0x21: 2, // HMP1
+	0x22: 2, // HMM0
+	0x23: 2, // HMM1
+	0x24: 2, // HMBL
+	0x2a: 6, // HMOVE
+	0x2b: 2, // HMCLR
+}
+
+func (tia *tia) queueWrite(addr, val byte) {
+	tia.PendingWrites = append(tia.PendingWrites, tiaWrite{
+		Addr:  addr,
+		Val:   val,
+		Delay: tiaWriteCycleClocks + tiaWriteDelays[addr],
+	})
+}
+
+// runPendingWrites is called at the start of each color
+// clock, applying any writes whose time has come.
+func (tia *tia) runPendingWrites() {
+	n := 0
+	for _, w := range tia.PendingWrites {
+		if w.Delay == 0 {
+			tia.writeReg(w.Addr, w.Val)
+		} else {
+			w.Delay--
+			tia.PendingWrites[n] = w
+			n++
+		}
+	}
+	tia.PendingWrites = tia.PendingWrites[:n]
+}
+
+func (tia *tia) writeReg(addr, val byte) {
+	switch addr {
+	case 0x00:
+		tia.InVSync = val&0x02 != 0
+	case 0x01:
+		tia.InVBlank = val&0x02 != 0
+	case 0x03:
+		tia.resetHorizCounter()
+	case 0x04:
+		tia.P0.RepeatMode = val & 0x07
+		tia.M0.RepeatMode = val & 0x07
+		tia.M0.Size = 1 << ((val >> 4) & 3)
+	case 0x05:
+		tia.P1.RepeatMode = val & 0x07
+		tia.M1.RepeatMode = val & 0x07
+		tia.M1.Size = 1 << ((val >> 4) & 3)
+	case 0x06:
+		tia.P0.ColorLuma = val & 0xfe
+	case 0x07:
+		tia.P1.ColorLuma = val & 0xfe
+	case 0x08:
+		tia.PlayfieldAndBallColorLuma = val & 0xfe
+	case 0x09:
+		tia.BGColorLuma = val & 0xfe
+	case 0x0a:
+		boolsFromByte(val,
+			nil, nil, nil, nil, nil,
+			&tia.PFAndBLHavePriority,
+			&tia.PlayfieldScoreColorMode,
+			&tia.PlayfieldReflect,
+		)
+		tia.BL.Size = 1 << ((val >> 4) & 3)
+	case 0x0b:
+		tia.P0.Reflect = val&0x08 != 0
+	case 0x0c:
+		tia.P1.Reflect = val&0x08 != 0
+	case 0x0d:
+		tia.PlayfieldToLoad &^= 0x0f0000
+		tia.PlayfieldToLoad |= uint32(reverseByte(val)&0x0f) << 16
+	case 0x0e:
+		tia.PlayfieldToLoad &^= 0x00ff00
+		tia.PlayfieldToLoad |= uint32(val) << 8
+	case 0x0f:
+		tia.PlayfieldToLoad &^= 0x0000ff
+		tia.PlayfieldToLoad |= uint32(reverseByte(val))
+
+	case 0x10:
+		tia.resetP0()
+	case 0x11:
+		tia.resetP1()
+	case 0x12:
+		tia.resetM0()
+	case 0x13:
+		tia.resetM1()
+	case 0x14:
+		tia.resetBL()
+
+	case 0x1b:
+		tia.loadShapeP0(val)
+	case 0x1c:
+		tia.loadShapeP1(val)
+	case 0x1d:
+		tia.M0.Show = val&0x02 != 0
+	case 0x1e:
+		tia.M1.Show = val&0x02 != 0
+	case 0x1f:
+		tia.loadEnablBL(val&0x02 != 0)
+	case 0x20:
+		tia.P0.Vx = int8(val&0xf0) >> 4
+	case 0x21:
+		tia.P1.Vx = int8(val&0xf0) >> 4
+	case 0x22:
+		tia.M0.Vx = int8(val&0xf0) >> 4
+	case 0x23:
+		tia.M1.Vx = int8(val&0xf0) >> 4
+	case 0x24:
+		tia.BL.Vx = int8(val&0xf0) >> 4
+	case 0x25:
+		tia.DelayGRP0 = val&0x01 != 0
+	case 0x26:
+		tia.DelayGRP1 = val&0x01 != 0
+	case 0x27:
+		tia.DelayGRBL = val&0x01 != 0
+	case 0x28:
+		tia.HideM0 = val&0x02 != 0
+	case 0x29:
+		tia.HideM1 = val&0x02 != 0
+	case 0x2a:
+		tia.applyHorizMotion()
+	case 0x2b:
+		tia.clearHorizMotion()
+	case 0x2c:
+		tia.clearCollisions()
+	}
+}
+
 func bitsToStr(val byte) string {
 	return fmt.Sprintf("%v%v%v%v%v%v%v%v",
 		val>>7&1, val>>6&1, val>>5&1, val>>4&1,
@@ -103,45 +297,124 @@ func (tia *tia) loadEnablBL(val bool) {
 	tia.BL.Show = val
 }
 
-func (s *sprite) move(vx int8) {
-	x := int(s.X) - int(vx)
-	for x < 0 {
-		x += 160
+// hmoveClocks is how many HMOVE clocks it takes to get to Vx
+// (HMxx's top nibble with its sign bit flipped)
+func (s *sprite) hmoveClocks() byte {
+	return byte(s.Vx)&0x0f ^ 0x08
+}
+
+// Clocks between a copy's start and its first pixel. Players
+// start a clock later than missiles and the ball, and double
+// and quad width players another clock later still.
+const (
+	missileStartDelay    = 4
+	playerStartDelay     = 5
+	widePlayerStartDelay = 6
+)
+
+// which copies (bit 0: +16, 1: +32, 2: +64) each NUSIZ mode has
+var nusizCopies = [8]byte{0, 1, 2, 3, 4, 0, 6, 0}
+
+// clock moves the graphics scan along (for a copy width pixels
+// wide, each div clocks long) then the position counter, which
+// starts a copy if it lands on one.
+func (s *sprite) clock(width, div, copies, startDelay byte) {
+	if s.Scanning {
+		if s.ScanSub++; s.ScanSub >= div {
+			s.ScanSub = 0
+			if s.ScanBit++; s.ScanBit >= width {
+				s.Scanning = false
+			}
+		}
 	}
-	for x >= 160 {
-		x -= 160
+	if s.StartDelay > 0 {
+		if s.StartDelay--; s.StartDelay == 0 {
+			s.Scanning = true
+			s.ScanBit, s.ScanSub = 0, 0
+		}
 	}
-	s.X = byte(x)
-}
 
-func (tia *tia) resetP0() { tia.resetPlayer(&tia.P0) }
-func (tia *tia) resetP1() { tia.resetPlayer(&tia.P1) }
-func (tia *tia) resetM0() { tia.resetMissile(&tia.M0) }
-func (tia *tia) resetM1() { tia.resetMissile(&tia.M1) }
-func (tia *tia) resetBL() { tia.resetBall(&tia.BL) }
+	if s.X++; s.X >= 160 {
+		s.X = 0
+	}
+	start := false
+	switch s.X {
+	case 0:
+		start = true
+	case 16:
+		start = copies&1 != 0
+	case 32:
+		start = copies&2 != 0
+	case 64:
+		start = copies&4 != 0
+	}
+	if start {
+		s.StartDelay = startDelay
+	}
+}
 
-func (tia *tia) resetPlayer(player *sprite) {
-	if tia.InHBlank {
-		player.X = 3
-	} else {
-		player.X = byte(tia.ScreenX+5) % 160
+// playerScan is the pixel length and start delay for a NUSIZ mode
+func playerScan(repeatMode byte) (div, startDelay byte) {
+	switch repeatMode {
+	case 5:
+		return 2, widePlayerStartDelay
+	case 7:
+		return 4, widePlayerStartDelay
 	}
+	return 1, playerStartDelay
 }
-func (tia *tia) resetMissile(missile *sprite) {
-	if tia.InHBlank {
-		missile.X = 2
-	} else {
-		missile.X = byte(tia.ScreenX+4) % 160
+
+// NUSIZ is read every clock, so changing it mid-copy changes
+// the width of the pixels left to draw.
+func (s *sprite) clockPlayer() {
+	div, startDelay := playerScan(s.RepeatMode)
+	s.clock(8, div, nusizCopies[s.RepeatMode], startDelay)
+}
+func (s *sprite) clockMissile() {
+	s.clock(s.Size, 1, nusizCopies[s.RepeatMode], missileStartDelay)
+}
+func (s *sprite) clockBall() {
+	s.clock(s.Size, 1, 0, missileStartDelay)
+}
+
+// clockSprite clocks sprites()[i]
+func (tia *tia) clockSprite(i int) {
+	switch i {
+	case 0:
+		tia.P0.clockPlayer()
+	case 1:
+		tia.P1.clockPlayer()
+	case 2:
+		tia.M0.clockMissile()
+	case 3:
+		tia.M1.clockMissile()
+	case 4:
+		tia.BL.clockBall()
 	}
 }
-func (tia *tia) resetBall(ball *sprite) {
+
+func (tia *tia) resetP0() { tia.resetPos(&tia.P0) }
+func (tia *tia) resetP1() { tia.resetPos(&tia.P1) }
+func (tia *tia) resetM0() { tia.resetPos(&tia.M0) }
+func (tia *tia) resetM1() { tia.resetPos(&tia.M1) }
+func (tia *tia) resetBL() { tia.resetPos(&tia.BL) }
+
+// resetPos is RESxx. It only resets the position counter, so
+// a copy being drawn carries on, and the main copy isn't drawn
+// until the counter comes back round, on the next line. Position
+// counters stop during HBLANK, so objects reset then all end up
+// near the left edge, wherever HBLANK ends.
+func (tia *tia) resetPos(s *sprite) {
 	if tia.InHBlank {
-		ball.X = 2
+		s.X = resetInHBlankX
 	} else {
-		ball.X = byte(tia.ScreenX+4) % 160
+		s.X = 0
 	}
 }
 
+// puts players at pixel 3, missiles and the ball at 2
+const resetInHBlankX = 2
+
 type collisions struct {
 	M0P1, M0P0 bool
 	M1P0, M1P1 bool
@@ -161,7 +434,16 @@ func (tia *tia) clearCollisions() {
 }
 
 func (tia *tia) applyHorizMotion() {
-	tia.HMoveRequested = true
+	tia.HMoveLatch = true
+	tia.HMoveActive = true
+	tia.HMoveClock = 0
+	for _, s := range tia.sprites() {
+		s.Moving = true
+	}
+}
+
+func (tia *tia) sprites() [5]*sprite {
+	return [5]*sprite{&tia.P0, &tia.P1, &tia.M0, &tia.M1, &tia.BL}
 }
 
 func (tia *tia) clearHorizMotion() {
@@ -193,93 +475,27 @@ func (tia *tia) getPlayfieldBit() bool {
 }
 
 func (tia *tia) getBallBit() bool {
-	x := tia.ScreenX
-	blX := int(tia.BL.X)
-	blSz := int(tia.BL.Size)
-	return x >= blX && x < blX+blSz
-}
-
-var playerModeTable = [8][9]byte{
-	{1, 0, 0, 0, 0, 0, 0, 0, 0},
-	{1, 0, 1, 0, 0, 0, 0, 0, 0},
-	{1, 0, 0, 0, 1, 0, 0, 0, 0},
-	{1, 0, 1, 0, 1, 0, 0, 0, 0},
-	{1, 0, 0, 0, 0, 0, 0, 0, 1},
-	{1, 1, 0, 0, 0, 0, 0, 0, 0},
-	{1, 0, 0, 0, 1, 0, 0, 0, 1},
-	{1, 1, 1, 1, 0, 0, 0, 0, 0},
+	return tia.BL.Scanning && tia.BL.ScanBit < tia.BL.Size
 }
 
 func (tia *tia) getPlayerBit(player *sprite, delay bool) bool {
+	if !player.Scanning {
+		return false
+	}
 
 	shape := player.Shape
 	if delay {
 		shape = player.LatchedShape
 	}
 
-	if shape == 0 {
-		return false
-	}
-
-	pX := tia.ScreenX - int(player.X)
-	if pX < 0 || pX >= 9*8 {
-		// NOTE: wrapping may not work this way? Might just be
-		// the single copy of a player that's crossing the 160
-		// border, not all copies...
-		pXWrap := tia.ScreenX - (int(player.X) - 160)
-		if pXWrap >= 0 && pXWrap < 9*8 {
-			pX = pXWrap
-		} else {
-			return false
-		}
-	}
-
-	col := pX >> 3
-	if playerModeTable[player.RepeatMode][col] == 0 {
-		return false
-	}
-
-	shapeX := uint(pX)
-	if player.RepeatMode == 5 {
-		shapeX >>= 1 // double width
-	} else if player.RepeatMode == 7 {
-		shapeX >>= 2 // quad width
-	}
-	shapeX &= 7
-
 	if player.Reflect {
-		return (shape>>shapeX)&1 > 0
+		return (shape>>player.ScanBit)&1 > 0
 	}
-	return shape<<shapeX >= 0x80
-}
-
-// same as player, save no double or quad mode
-var missileModeTable = [8][9]byte{
-	{1, 0, 0, 0, 0, 0, 0, 0, 0},
-	{1, 0, 1, 0, 0, 0, 0, 0, 0},
-	{1, 0, 0, 0, 1, 0, 0, 0, 0},
-	{1, 0, 1, 0, 1, 0, 0, 0, 0},
-	{1, 0, 0, 0, 0, 0, 0, 0, 1},
-	{1, 0, 0, 0, 0, 0, 0, 0, 0},
-	{1, 0, 0, 0, 1, 0, 0, 0, 1},
-	{1, 0, 0, 0, 0, 0, 0, 0, 0},
+	return shape<<player.ScanBit >= 0x80
 }
 
 func (tia *tia) getMissileBit(missile *sprite) bool {
-
-	mX := tia.ScreenX - int(missile.X)
-	if mX < 0 || mX >= 9*8 {
-		return false
-	}
-
-	col := mX >> 3
-	if missileModeTable[missile.RepeatMode][col] == 0 {
-		return false
-	}
-
-	shapeX := mX
-	shapeX &= 7
-	return shapeX <= int(missile.Size)-1
+	return missile.Scanning && missile.ScanBit < missile.Size
 }
 
 func (tia *tia) drawRGB(x, y int, r, g, b byte) {
@@ -309,19 +525,22 @@ func (tia *tia) drawColor(colorLuma byte) {
 	tia.drawRGB(tia.ScreenX, tia.ScreenY, col[0], col[1], col[2])
 }
 
+// lockMissileToPlayer keeps the missile's counter where it
+// would start drawing offset pixels into the player
 func (s *sprite) lockMissileToPlayer(player *sprite) {
-	s.X = player.X
+	offset := 4
 	if player.RepeatMode == 5 {
-		s.X += 8
+		offset = 8
 	} else if player.RepeatMode == 7 {
-		s.X += 16
-	} else {
-		s.X += 4
+		offset = 16
 	}
-	// TODO: should it wrap?
-	s.X %= 160
+	_, startDelay := playerScan(player.RepeatMode)
+	offset += int(startDelay) - missileStartDelay
+	s.X = byte((int(player.X) - offset + 160) % 160)
 }
 
+const defaultDisplayStartLine = 37
+
 func (tia *tia) setTVFormat(format TVFormat) {
 	tia.TVFormat = format
 	tia.FormatSet = true
@@ -347,38 +566,52 @@ func (tia *tia) startVSync() {
 			if tia.PALFrameCountStart == 0 {
 				tia.PALFrameCountStart = tia.FrameCount
 			} else if tia.FrameCount-tia.PALFrameCountStart >= 20 {
-				fmt.Println("Detected PAL!")
+				tia.log.logf(LogInfo, LogTIA, "Detected PAL!")
 				tia.setTVFormat(FormatPAL)
 			}
 		} else {
 			if tia.NTSCFrameCountStart == 0 {
 				tia.NTSCFrameCountStart = tia.FrameCount
 			} else if tia.FrameCount-tia.NTSCFrameCountStart >= 20 {
-				fmt.Println("Detected NTSC!")
+				tia.log.logf(LogInfo, LogTIA, "Detected NTSC!")
 				tia.setTVFormat(FormatNTSC)
 			}
 		}
 	}
 }
 
-func (tia *tia) hmove() {
-	tia.HMoveRequested = false
-	if tia.InHBlank {
-		// tia.HMoveCombEnabled = true
-		tia.P0.move(tia.P0.Vx)
-		tia.P1.move(tia.P1.Vx)
-		tia.M0.move(tia.M0.Vx)
-		tia.M1.move(tia.M1.Vx)
-		tia.BL.move(tia.BL.Vx)
+// runHMoveClock sends an HMOVE clock to each object still moving,
+// if it's time for one. The clocks only move objects during HBLANK;
+// anywhere else they land on top of the usual clocks and are lost.
+//
+// When HMOVE is strobed at the start of a line, HBLANK is extended
+// and objects miss 8 clocks, so Vx+8 HMOVE clocks moves them Vx
+// pixels left. Strobed late in the line, HBLANK isn't extended, and
+// objects move Vx+8 pixels (the "no comb" trick). Changing HMxx
+// while HMOVE is running changes when its object stops; if the new
+// value's already been passed, it keeps moving.
+func (tia *tia) runHMoveClock() {
+	if tia.ScreenX&3 != 0 {
+		return
+	}
+	clock := tia.HMoveClock
+	if clock > 15 {
+		// the counter's done, and reads as zero from here on
+		clock = 0
 	} else {
-		// FIXME: right now I'm just assuming that anything
-		// that's HMOVEing early is trying the no-comb trick,
-		// which is not necessarily true...
-		tia.P0.move(tia.P0.Vx + 8)
-		tia.P1.move(tia.P1.Vx + 8)
-		tia.M0.move(tia.M0.Vx + 8)
-		tia.M1.move(tia.M1.Vx + 8)
-		tia.BL.move(tia.BL.Vx + 8)
+		tia.HMoveClock++
+	}
+	tia.HMoveActive = false
+	for i, s := range tia.sprites() {
+		if clock == s.hmoveClocks() {
+			s.Moving = false
+		}
+		if s.Moving {
+			tia.HMoveActive = true
+			if tia.InHBlank {
+				tia.clockSprite(i)
+			}
+		}
 	}
 }
 
@@ -459,68 +692,99 @@ func (tia *tia) computeColorAndUpdateCollision() byte {
 	return colorLuma
 }
 
-func (tia *tia) runThreeCycles() {
-
-	if tia.HideM0 {
-		tia.M0.lockMissileToPlayer(&tia.P0)
+// computePlayfieldColor is the color with no objects and
+// no collisions, for the comb's pixels when it's hidden.
+func (tia *tia) computePlayfieldColor() byte {
+	if !tia.getPlayfieldBit() {
+		return tia.BGColorLuma
 	}
-	if tia.HideM1 {
-		tia.M1.lockMissileToPlayer(&tia.P1)
-	}
-	if tia.HMoveRequested {
-		tia.hmove()
+	if tia.PlayfieldScoreColorMode && !tia.PFAndBLHavePriority {
+		// comb's always on the left
+		return tia.P0.ColorLuma
 	}
+	return tia.PlayfieldAndBallColorLuma
+}
 
-	if !tia.WasInVSync && tia.InVSync {
-		tia.startVSync()
-	} else if tia.WasInVSync && !tia.InVSync {
-		tia.WasInVSync = false
+func (tia *tia) runThreeCycles() {
 
-		// blank rest of screen
-		for y := tia.ScreenY; y < 264; y++ {
-			for x := tia.ScreenX; x < 160; x++ {
-				tia.drawRGB(x, y, 0, 0, 0)
-			}
+	for i := 0; i < 3; i++ {
+
+		if len(tia.PendingWrites) > 0 {
+			tia.runPendingWrites()
 		}
 
-		// NOTE: Found PAL roms that expect less than 45 lines
-		// of upper border, so leaving this as is for now.
-		tia.ScreenY = -37
-	}
+		if tia.HideM0 {
+			tia.M0.lockMissileToPlayer(&tia.P0)
+		}
+		if tia.HideM1 {
+			tia.M1.lockMissileToPlayer(&tia.P1)
+		}
+
+		if !tia.WasInVSync && tia.InVSync {
+			tia.startVSync()
+		} else if tia.WasInVSync && !tia.InVSync {
+			tia.WasInVSync = false
+
+			// blank rest of screen (a VSYNC can come back around
+			// before the picture starts, so clamp to it)
+			for y := tia.ScreenY; y < 264; y++ {
+				for x := tia.ScreenX; x < 160; x++ {
+					if y >= 0 && x >= 0 {
+						tia.drawRGB(x, y, 0, 0, 0)
+					}
+				}
+			}
 
-	/*
-		if !tia.WasInVBlank && tia.InVBlank {
-			tia.WasInVBlank = true
-			fmt.Printf("Enter VBlank at %3d", tia.ScreenY)
-		} else if tia.WasInVBlank && !tia.InVBlank {
-			tia.WasInVBlank = false
-			fmt.Println(" / Exit VBlank at", tia.ScreenY)
+			// NOTE: Found PAL roms that expect less than 45 lines
+			// of upper border, so leaving this as is for now.
+			tia.ScreenY = -tia.DisplayStartLine
 		}
-	*/
 
-	for i := 0; i < 3; i++ {
+		/*
+			if !tia.WasInVBlank && tia.InVBlank {
+				tia.WasInVBlank = true
+				fmt.Printf("Enter VBlank at %3d", tia.ScreenY)
+			} else if tia.WasInVBlank && !tia.InVBlank {
+				tia.WasInVBlank = false
+				fmt.Println(" / Exit VBlank at", tia.ScreenY)
+			}
+		*/
 
 		if tia.ScreenX >= 0 && tia.ScreenX < 160 {
 
 			if tia.ScreenX == 0 {
-				tia.InHBlank = false
+				tia.ExtendedHBlank = tia.HMoveLatch
+				tia.InHBlank = tia.ExtendedHBlank
 			} else if tia.ScreenX == 8 {
-				tia.HMoveCombEnabled = false
+				tia.ExtendedHBlank = false
+				tia.InHBlank = false
 			}
 
 			colorLuma := byte(0)
-			if !tia.InVBlank && !tia.HMoveCombEnabled {
-				colorLuma = tia.computeColorAndUpdateCollision()
+			if !tia.InVBlank {
+				if !tia.ExtendedHBlank {
+					colorLuma = tia.computeColorAndUpdateCollision()
+				} else if tia.hideHMoveComb {
+					colorLuma = tia.computePlayfieldColor()
+				}
 			}
 
 			if tia.ScreenY >= 0 && tia.ScreenY < 264 {
 				tia.drawColor(colorLuma)
 			}
 
+			if !tia.InHBlank {
+				tia.P0.clockPlayer()
+				tia.P1.clockPlayer()
+				tia.M0.clockMissile()
+				tia.M1.clockMissile()
+				tia.BL.clockBall()
+			}
+
 		} else if tia.ScreenX == 160 {
 			tia.ScreenX = -68
-			tia.WaitForHBlank = false
 			tia.InHBlank = true
+			tia.HMoveLatch = false
 			if tia.ScreenY++; tia.ScreenY > 275 {
 				// if a program doesn't vsync, lets just hang
 				// out here at the end of the screen...
@@ -528,6 +792,10 @@ func (tia *tia) runThreeCycles() {
 			}
 		}
 
+		if tia.HMoveActive {
+			tia.runHMoveClock()
+		}
+
 		// NOTE: Load every four pixels is correct, but don't be surprised
 		// if what offset we do it at changes when other things are fixed...
 		if tia.ScreenX&3 == 3 {
@@ -535,5 +803,11 @@ func (tia *tia) runThreeCycles() {
 		}
 
 		tia.ScreenX++
+
+		if tia.ScreenX == 160 {
+			// WSYNC lets the CPU go at the end of the line,
+			// so it's ready to run on the first cycle of HBLANK
+			tia.WaitForHBlank = false
+		}
 	}
 }
@@ -0,0 +1,462 @@
+package vcsgo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// asm builds tiny 6502 test kernels
+type asm struct{ b []byte }
+
+func (a *asm) op(bs ...byte) { a.b = append(a.b, bs...) }
+func (a *asm) lda(v byte)    { a.op(0xa9, v) }
+func (a *asm) sta(zp byte)   { a.op(0x85, zp) }
+func (a *asm) wsync()        { a.sta(0x02) }
+
+func (a *asm) nops(n int) {
+	for i := 0; i < n; i++ {
+		a.op(0xea)
+	}
+}
+
+// lines waits out n lines
+func (a *asm) lines(n byte) {
+	a.op(0xa0, n) // LDY #n
+	loop := len(a.b)
+	a.wsync()
+	a.op(0x88)                          // DEY
+	a.op(0xd0, byte(loop-(len(a.b)+2))) // BNE loop
+}
+
+// A write made by a STA zp that starts on CPU cycle c of a line
+// (counting from the end of WSYNC) lands on pixel 3*(c+3)-68.
+func landingPixel(c int) int { return 3*(c+3) - 68 }
+
+// testKernel makes a 4K ROM whose frame runs setup (with all
+// objects off and COLUP0 lit), then on a line well down the
+// screen runs line, then idles out the frame.
+func testKernel(setup, line func(a *asm)) []byte {
+	a := &asm{}
+	a.lda(2)
+	a.sta(0x00) // VSYNC
+	a.wsync()
+	a.wsync()
+	a.wsync()
+	a.lda(0)
+	a.sta(0x00)
+	a.sta(0x01) // VBLANK
+	a.sta(0x09) // COLUBK
+	a.sta(0x1b) // GRP0
+	a.sta(0x1c) // GRP1
+	a.sta(0x1d) // ENAM0
+	a.sta(0x1e) // ENAM1
+	a.sta(0x1f) // ENABL
+	a.lda(0x0e)
+	a.sta(0x06) // COLUP0
+	a.sta(0x08) // COLUPF
+	setup(a)
+	a.lines(50)
+	a.wsync()
+	line(a)
+	a.wsync()
+	a.op(0xa2, 200) // LDX #200
+	loop := len(a.b)
+	a.wsync()
+	a.op(0xca)                          // DEX
+	a.op(0xd0, byte(loop-(len(a.b)+2))) // BNE loop
+	a.op(0x4c, 0x00, 0xf0)              // JMP $f000
+
+	rom := make([]byte, 4096)
+	copy(rom, a.b)
+	rom[0xffc], rom[0xffd] = 0x00, 0xf0
+	return rom
+}
+
+func runTestFrames(t *testing.T, rom []byte, opts Options, frames int) *emuState {
+	opts.ForceTVFormat = true
+	emu, err := newState(rom, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for f := 0; f < frames; f++ {
+		for !emu.FlipRequested() {
+			emu.Step()
+			if emu.err != nil {
+				t.Fatal(emu.err)
+			}
+		}
+	}
+	return emu
+}
+
+// litRuns lists the lit pixels of line y, e.g. "3-10 19-26"
+func litRuns(emu *emuState, y int) string {
+	runs := []string{}
+	start := -1
+	for x := 0; x <= 160; x++ {
+		lit := x < 160 && emu.TIA.Screen[(y*320+2*x)*4] != 0
+		if lit && start < 0 {
+			start = x
+		} else if !lit && start >= 0 {
+			runs = append(runs, fmt.Sprintf("%d-%d", start, x-1))
+			start = -1
+		}
+	}
+	return strings.Join(runs, " ")
+}
+
+// kernelLines runs a test kernel and returns how the top of the
+// screen looks, with runs of identical lines listed once.
+func kernelLines(t *testing.T, setup, line func(a *asm)) []string {
+	return kernelLinesWith(t, Options{}, setup, line)
+}
+
+func kernelLinesWith(t *testing.T, opts Options, setup, line func(a *asm)) []string {
+	emu := runTestFrames(t, testKernel(setup, line), opts, 3)
+	lines := []string{}
+	for y := 0; y < 100; y++ {
+		if l := litRuns(emu, y); len(lines) == 0 || l != lines[len(lines)-1] {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+func checkLines(t *testing.T, name string, got []string, want ...string) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%v: got %q, want %q", name, got, want)
+	}
+}
+
+// resetAt strobes reg from a STA starting on cycle c of the line
+// (c even, at least 0)
+func resetAt(a *asm, reg byte, c int) {
+	a.nops(c / 2)
+	a.sta(reg)
+}
+
+func TestObjectStartDelays(t *testing.T) {
+	objects := []struct {
+		name  string
+		reg   byte
+		setup func(a *asm)
+		delay int
+		width int
+	}{
+		{"P0", 0x10, func(a *asm) { a.lda(0xff); a.sta(0x1b) }, 5, 8},
+		{"M0", 0x12, func(a *asm) { a.lda(0x30); a.sta(0x04); a.lda(2); a.sta(0x1d) }, 4, 8},
+		{"BL", 0x14, func(a *asm) { a.lda(0x30); a.sta(0x0a); a.lda(2); a.sta(0x1f) }, 4, 8},
+		{"P0 double", 0x10, func(a *asm) { a.lda(0xff); a.sta(0x1b); a.lda(5); a.sta(0x04) }, 6, 16},
+		{"P0 quad", 0x10, func(a *asm) { a.lda(0xff); a.sta(0x1b); a.lda(7); a.sta(0x04) }, 6, 32},
+	}
+	for _, o := range objects {
+		for c := 24; c <= 60; c += 6 {
+			lines := kernelLines(t, func(a *asm) {
+				o.setup(a)
+				a.wsync()
+				resetAt(a, o.reg, c)
+			}, func(a *asm) {})
+			x := landingPixel(c) + o.delay
+			want := fmt.Sprintf("%d-%d", x, x+o.width-1)
+			checkLines(t, fmt.Sprintf("%v reset on cycle %v", o.name, c), lines, want)
+		}
+	}
+}
+
+// A player's first pixel comes one clock after a missile's (or
+// the ball's) would for a reset on the same cycle, as the player
+// scan takes a clock longer to start.
+func TestPlayerStartsOneClockLate(t *testing.T) {
+	for c := 24; c <= 60; c += 12 {
+		lines := kernelLines(t, func(a *asm) {
+			a.lda(0x80)
+			a.sta(0x1b) // GRP0, one pixel
+			a.lda(2)
+			a.sta(0x1d) // ENAM0, one pixel
+			a.wsync()
+			resetAt(a, 0x10, c)
+			a.wsync()
+			resetAt(a, 0x12, c)
+		}, func(a *asm) {})
+		m := landingPixel(c) + missileStartDelay
+		want := fmt.Sprintf("%d-%d", m, m+1)
+		checkLines(t, fmt.Sprintf("P0 and M0 reset on cycle %v", c), lines, want)
+	}
+}
+
+// Resets during HBLANK put players at pixel 3, and missiles and
+// the ball at 2, as their counters start when HBLANK ends.
+func TestObjectResetInHBlank(t *testing.T) {
+	for _, c := range []struct {
+		reg   byte
+		setup func(a *asm)
+		want  string
+	}{
+		{0x10, func(a *asm) { a.lda(0xff); a.sta(0x1b) }, "3-10"},
+		{0x12, func(a *asm) { a.lda(0x30); a.sta(0x04); a.lda(2); a.sta(0x1d) }, "2-9"},
+		{0x14, func(a *asm) { a.lda(0x30); a.sta(0x0a); a.lda(2); a.sta(0x1f) }, "2-9"},
+	} {
+		lines := kernelLines(t, func(a *asm) {
+			c.setup(a)
+			a.wsync()
+			resetAt(a, c.reg, 10)
+		}, func(a *asm) {})
+		checkLines(t, fmt.Sprintf("reset %02x in hblank", c.reg), lines, c.want)
+	}
+}
+
+// RESP0 only resets the position counter: the main copy isn't
+// started again until the counter wraps, on the next line, but a
+// copy after it is started on the same line.
+func TestResetLineDrawsOnlyLaterCopies(t *testing.T) {
+	lines := kernelLines(t, func(a *asm) {
+		a.lda(0xff)
+		a.sta(0x1b)
+		a.lda(1) // two copies, close
+		a.sta(0x04)
+		a.wsync()
+		resetAt(a, 0x10, 40) // lands 61, player at 66
+	}, func(a *asm) {
+		resetAt(a, 0x10, 30) // lands 31, player at 36
+	})
+	checkLines(t, "RESP0 with close copies", lines,
+		"66-73 82-89", // before
+		"52-59",       // reset line: only the second copy
+		"36-43 52-59", // after
+	)
+}
+
+// A reset landing mid-copy doesn't cut the copy short
+func TestResetDuringDraw(t *testing.T) {
+	lines := kernelLines(t, func(a *asm) {
+		a.lda(0xff)
+		a.sta(0x1b)
+		a.wsync()
+		resetAt(a, 0x10, 40) // player at 66
+	}, func(a *asm) {
+		resetAt(a, 0x10, 42) // lands 67, on the copy's second pixel
+	})
+	checkLines(t, "RESP0 during draw", lines, "66-73", "72-79")
+}
+
+// NUSIZ is read as the copy is drawn, so changing it mid-copy
+// changes the width of what's left.
+func TestNUSIZChangeMidCopy(t *testing.T) {
+	lines := kernelLines(t, func(a *asm) {
+		a.lda(0xff)
+		a.sta(0x1b)
+		a.wsync()
+		resetAt(a, 0x10, 40) // player at 66
+	}, func(a *asm) {
+		a.lda(7)
+		resetAt(a, 0x04, 40) // quad from 67, after one pixel
+		a.lda(0)
+		a.sta(0x04) // and back to single from 82
+	})
+	checkLines(t, "NUSIZ 1x to 4x", lines,
+		"66-73",
+		"66-85", // 1 single pixel, 3 quad bits and a bit, 4 singles
+		"66-73",
+	)
+
+	lines = kernelLines(t, func(a *asm) {
+		a.lda(0xf0)
+		a.sta(0x1b)
+		a.lda(7)
+		a.sta(0x04)
+		a.wsync()
+		resetAt(a, 0x10, 40) // quad player at 67
+	}, func(a *asm) {
+		a.lda(0)
+		resetAt(a, 0x04, 42) // single from 73, mid second bit
+		a.lda(7)
+		a.sta(0x04)
+	})
+	checkLines(t, "NUSIZ 4x to 1x", lines, "67-82", "67-75", "67-82")
+}
+
+// A second VSYNC before the picture starts (as some games do
+// while they set up) ends with the beam above the screen, so
+// there's none of the screen left to blank.
+func TestVSyncBeforePictureStarts(t *testing.T) {
+	rom := testKernel(func(a *asm) {
+		a.lines(5)
+		a.lda(2)
+		a.sta(0x00) // VSYNC again
+		a.wsync()
+		a.wsync()
+		a.wsync()
+		a.lda(0)
+		a.sta(0x00)
+		a.lda(0xff)
+		a.sta(0x1b) // GRP0
+		a.wsync()
+		resetAt(a, 0x10, 40) // player at 66
+	}, func(a *asm) {})
+	emu := runTestFrames(t, rom, Options{}, 6)
+	if got := litRuns(emu, 40); got != "66-73" {
+		t.Errorf("got %q on the screen, want %q", got, "66-73")
+	}
+}
+
+// hmoveKernel sets HMP0 and puts a player at 66, then runs line
+func hmoveKernel(t *testing.T, hmp0 byte, line func(a *asm)) []string {
+	return kernelLines(t, func(a *asm) {
+		a.lda(0)
+		a.sta(0x20) // HMP0
+		a.sta(0x2a) // HMOVE, so nothing's still moving from last frame
+		a.wsync()
+		a.lda(0xff)
+		a.sta(0x1b) // GRP0
+		a.lda(hmp0)
+		a.sta(0x20)
+		a.wsync()
+		resetAt(a, 0x10, 40)
+	}, line)
+}
+
+// HMOVE at the start of a line moves players Vx pixels, left
+// for positive values, from that line on.
+func TestHMoveAtLineStart(t *testing.T) {
+	for _, c := range []struct {
+		hmp0 byte
+		want string
+	}{
+		{0x00, "66-73"},
+		{0x30, "63-70"},
+		{0x70, "59-66"},
+		{0xd0, "69-76"},
+		{0x80, "74-81"},
+	} {
+		lines := hmoveKernel(t, c.hmp0, func(a *asm) {
+			a.sta(0x2a) // HMOVE
+		})
+		want := []string{"66-73", c.want}
+		if c.want == "66-73" {
+			want = want[:1]
+		}
+		checkLines(t, fmt.Sprintf("HMP0 %02x, HMOVE on cycle 0", c.hmp0), lines, want...)
+	}
+}
+
+// HMOVE at the very end of a line doesn't extend the next line's
+// HBLANK, so objects get all their HMOVE clocks and move Vx+8.
+// A cycle later and it's a start-of-line HMOVE for the next line.
+func TestLateHMove(t *testing.T) {
+	for _, c := range []struct {
+		cycle int
+		want  string
+	}{
+		{62, "61-68"},
+		{66, "58-65"},
+		{70, "55-62"}, // 3+8 left
+		{72, "63-70"},
+	} {
+		lines := hmoveKernel(t, 0x30, func(a *asm) {
+			resetAt(a, 0x2a, c.cycle)
+		})
+		checkLines(t, fmt.Sprintf("HMOVE on cycle %v", c.cycle), lines, "66-73", c.want)
+	}
+}
+
+// Changing HMxx while HMOVE runs changes when the object stops.
+// If its new count has already gone by, it never stops, and
+// picks up all 17 HBLANK clocks on every line after (as the
+// Cosmic Ark starfield does).
+func TestHMxxWriteDuringHMove(t *testing.T) {
+	hmoveThenHMP0At := func(c int) func(a *asm) {
+		return func(a *asm) {
+			a.sta(0x2a) // HMOVE
+			a.lda(0xc0) // 4 right, 4 HMOVE clocks
+			a.nops((c - 5) / 2)
+			a.sta(0x20) // HMP0
+		}
+	}
+
+	lines := hmoveKernel(t, 0x70, hmoveThenHMP0At(5))
+	checkLines(t, "HMP0 written before its count", lines, "66-73", "70-77")
+
+	lines = hmoveKernel(t, 0x70, hmoveThenHMP0At(11))
+	want := []string{"66-73", "59-66", "42-49", "25-32", "8-15", "151-158"}
+	if len(lines) < len(want) {
+		t.Fatalf("HMP0 written after its count: got %q, want it to keep moving", lines)
+	}
+	checkLines(t, "HMP0 written after its count", lines[:len(want)], want...)
+}
+
+// HMOVE at the start of a line blanks its first 8 pixels (the
+// comb), unless the comb's hidden, when the playfield and
+// background are drawn there. HMOVE later in the line leaves
+// no comb.
+func TestHMoveComb(t *testing.T) {
+	lightBK := func(a *asm) {
+		a.lda(0x0e)
+		a.sta(0x09) // COLUBK
+	}
+	pf0 := func(a *asm) {
+		a.lda(0xf0)
+		a.sta(0x0d) // PF0
+	}
+	hmoveAt := func(c int) func(a *asm) {
+		return func(a *asm) { resetAt(a, 0x2a, c) }
+	}
+	for _, c := range []struct {
+		name  string
+		hide  bool
+		setup func(a *asm)
+		line  func(a *asm)
+		want  []string
+	}{
+		{"HMOVE in HBLANK", false, lightBK, hmoveAt(0), []string{"0-159", "8-159", "0-159"}},
+		{"HMOVE mid-line", false, lightBK, hmoveAt(30), []string{"0-159"}},
+		{"HMOVE in HBLANK, comb hidden", true, lightBK, hmoveAt(0), []string{"0-159"}},
+		{"playfield", false, pf0, hmoveAt(0), []string{"0-15 80-95", "8-15 80-95", "0-15 80-95"}},
+		{"playfield, comb hidden", true, pf0, hmoveAt(0), []string{"0-15 80-95"}},
+	} {
+		lines := kernelLinesWith(t, Options{HideHMoveComb: c.hide}, c.setup, c.line)
+		checkLines(t, c.name, lines, c.want...)
+	}
+}
+
+// Nothing collides in the comb, hidden or not. With HMOVE, a
+// player at 3 is moved along by the HMOVE clocks so as to show
+// from 8 on, clear of the playfield at 0-7.
+func TestHMoveCombCollisions(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		hmove bool
+		hide  bool
+		want  bool
+	}{
+		{"no HMOVE", false, false, true},
+		{"HMOVE", true, false, false},
+		{"HMOVE, comb hidden", true, true, false},
+	} {
+		rom := testKernel(func(a *asm) {
+			a.sta(0x2b) // HMCLR
+			a.lda(0x30)
+			a.sta(0x0d) // PF0, pixels 0-7
+			a.sta(0x2c) // CXCLR
+			a.wsync()
+			resetAt(a, 0x10, 10) // player at 3
+		}, func(a *asm) {
+			if c.hmove {
+				a.sta(0x2a)
+			} else {
+				a.op(0xa5, 0x80) // LDA $80, as long as an STA
+			}
+			a.lda(0xff)
+			a.sta(0x1b) // GRP0, on this line only
+			a.nops(12)
+			a.lda(0)
+			a.sta(0x1b)
+		})
+		emu := runTestFrames(t, rom, Options{HideHMoveComb: c.hide}, 3)
+		if got := emu.TIA.Collisions.P0PF; got != c.want {
+			t.Errorf("%v: P0-PF collision %v, want %v", c.name, got, c.want)
+		}
+	}
+}
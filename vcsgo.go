@@ -2,8 +2,6 @@ package vcsgo
 
 import (
 	"fmt"
-	"math/rand"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -56,6 +54,13 @@ type emuState struct {
 	LastPaddleFrameReset          int
 	InputPotsBeingUsed            bool
 
+	// set when the cart DB says what controllers are used,
+	// so there's nothing to guess
+	ControllersKnown bool
+
+	PaddleRangeMin int16
+	PaddleRangeMax int16
+
 	Paddle0InputCharged bool
 	Paddle1InputCharged bool
 	Paddle2InputCharged bool
@@ -81,7 +86,23 @@ type emuState struct {
 
 	Cycles uint64
 
+	// Seed is what RNG started from. RNG is used wherever
+	// the hardware would be unpredictable, e.g. power on state.
+	Seed int64
+	RNG  rng
+
 	devMode bool
+
+	// set when emulation halts
+	err error
+
+	movieRecorder *movieRecorder
+	moviePlayer   *moviePlayer
+
+	rewind *rewindBuffer
+
+	cartProps      CartProperties
+	cartPropsKnown bool
 }
 
 func (emu *emuState) SetDevMode(b bool) { emu.devMode = b }
@@ -192,7 +213,7 @@ func (emu *emuState) handlePotTiming() {
 		&emu.Paddle2InputCharged, &emu.Paddle3InputCharged,
 	}
 	for i, paddle := range paddles {
-		scanLimit := paddlePosToScanlines(paddle.Position)
+		scanLimit := paddlePosToScanlines(paddle.Position, emu.PaddleRangeMin, emu.PaddleRangeMax)
 		if scanlines >= scanLimit {
 			*regs[i] = true
 		}
@@ -200,7 +221,7 @@ func (emu *emuState) handlePotTiming() {
 }
 
 func (emu *emuState) doPotHeuristics() {
-	if !emu.InputPotsBeingUsed {
+	if !emu.InputPotsBeingUsed && !emu.ControllersKnown {
 		if emu.LastPaddleFrameReset != emu.TIA.FrameCount {
 			emu.LastPaddleFrameReset = emu.TIA.FrameCount
 			emu.PaddleChecksLastFrame = emu.PaddleChecksThisFrame
@@ -212,7 +233,7 @@ func (emu *emuState) doPotHeuristics() {
 		if fewChecksButNoJoy || emu.PaddleChecksLastFrame >= 60 {
 			emu.PaddleCodeFrames++
 			if emu.PaddleCodeFrames >= 20 {
-				fmt.Println("Paddle code found: Joysticks disabled", emu.PaddleChecksLastFrame)
+				emu.logf(LogInfo, LogInput, "Paddle code found: Joysticks disabled %d", emu.PaddleChecksLastFrame)
 				emu.InputPotsBeingUsed = true
 			}
 		} else {
@@ -221,13 +242,15 @@ func (emu *emuState) doPotHeuristics() {
 	}
 }
 
-func paddlePosToScanlines(pos int16) int16 {
-	const outRange = 380
-	v := int16(float32(135-pos) / 270.0 * outRange)
-	if v < 0 {
-		return 0
-	} else if v > outRange {
-		return outRange
+func paddlePosToScanlines(pos, rangeMin, rangeMax int16) int16 {
+	if rangeMin == 0 && rangeMax == 0 {
+		rangeMax = 380
+	}
+	v := rangeMin + int16(float32(135-pos)/270.0*float32(rangeMax-rangeMin))
+	if v < rangeMin {
+		return rangeMin
+	} else if v > rangeMax {
+		return rangeMax
 	}
 	return v
 }
@@ -283,6 +306,10 @@ func getDbgCmd(cmdStr string) dbgCmd {
 
 func (emu *emuState) step() {
 
+	if emu.err != nil {
+		return
+	}
+
 	if emu.DebugKeyVal == '`' {
 		emu.DebugKeyPressed = false
 		emu.DebugContinue = false
@@ -312,7 +339,7 @@ func (emu *emuState) step() {
 
 		runUntil := func(cond func() bool, timeout time.Duration) {
 			start := time.Now()
-			for !cond() {
+			for !cond() && emu.err == nil {
 				emu.stepNoDbg()
 				if time.Now().Sub(start) > timeout {
 					fmt.Printf("TIMED OUT: ran to 0x%04x\n", emu.CPU.PC)
@@ -372,7 +399,25 @@ func (emu *emuState) step() {
 
 func (emu *emuState) stepNoDbg() {
 
+	if emu.moviePlayer != nil {
+		emu.moviePlayer.playMovieInput(emu)
+	}
+
 	emu.CPU.Step()
+
+	if emu.Mem.stallCycles > 0 {
+		stallCycles := emu.Mem.stallCycles
+		emu.Mem.stallCycles = 0
+		emu.runCycles(stallCycles)
+	}
+
+	if emu.moviePlayer != nil {
+		emu.moviePlayer.endIfDone(emu)
+	}
+
+	if emu.rewind != nil {
+		emu.rewind.captureFrame(emu)
+	}
 }
 
 func (emu *emuState) debugStatusLine() string {
@@ -421,20 +466,27 @@ func (emu *emuState) reset() {
 	emu.CPU.RESET = true
 }
 
-func initEmuState(emu *emuState, cart []byte, devMode bool) {
+func initEmuState(emu *emuState, cart []byte, opts Options) error {
+	devMode := opts.DevMode
+
+	mapper := loadMapperFromRomInfo(cart)
+	if opts.Mapper != "" {
+		var err error
+		if mapper, err = makeMapperFromName(opts.Mapper, cart); err != nil {
+			return err
+		}
+	}
+
 	*emu = emuState{
 		Mem: mem{
-			mapper: loadMapperFromRomInfo(cart),
-			rom:    cart,
+			mapper:       mapper,
+			rom:          cart,
+			MapperPinned: opts.Mapper != "",
+
+			RandomizeUndrivenBits: opts.RandomizeUndrivenTIABits,
 		},
 		Timer: timer{
 			Interval: 1024,
-
-			// NOTE: correct and important for
-			// random number generation in games,
-			// still, lets have determinism every
-			// start for the moment.
-			Val: byte(rand.Uint32()),
 		},
 		TIA: tia{
 			ScreenX:       -68,
@@ -443,9 +495,31 @@ func initEmuState(emu *emuState, cart []byte, devMode bool) {
 			M0:            sprite{Size: 1},
 			M1:            sprite{Size: 1},
 			ShowDebugPuck: devMode,
+
+			DisplayStartLine: defaultDisplayStartLine,
+
+			hideHMoveComb: opts.HideHMoveComb,
+		},
+		APU: apu{
+			sampleRate: opts.SampleRate,
 		},
 		devMode:       devMode,
 		DebugContinue: !devMode,
+
+		Seed: opts.Seed,
+		RNG:  newRNG(opts.Seed),
+	}
+
+	// NOTE: correct and important for
+	// random number generation in games
+	emu.Timer.Val = emu.RNG.byte()
+
+	emu.setLogSink(newLogSink(opts.Logger))
+	if opts.RewindCapacity > 0 {
+		emu.rewind = newRewindBuffer(opts.RewindCapacity, opts.RewindInterval)
+	}
+	if emu.APU.sampleRate == 0 {
+		emu.APU.sampleRate = defaultSampleRate
 	}
 
 	emu.CPU = virt6502.Virt6502{
@@ -453,61 +527,176 @@ func initEmuState(emu *emuState, cart []byte, devMode bool) {
 		RunCycles: emu.runCycles,
 		Write:     emu.write,
 		Read:      emu.read,
-		Err:       func(e error) { emuErr(e) },
+		Err:       emu.cpuErr,
+	}
+	if opts.RandomizeCPU {
+		emu.CPU.A = emu.RNG.byte()
+		emu.CPU.X = emu.RNG.byte()
+		emu.CPU.Y = emu.RNG.byte()
+		emu.CPU.S = emu.RNG.byte()
+		emu.CPU.P = emu.RNG.byte()
 	}
 	emu.APU.init(emu)
 	emu.TIA.init(emu)
 
-	// NOTE: random fill the RAM, but but still keep it
-	// deterministic every start for the moment...
-	rand.Read(emu.Mem.RAM[:])
+	if err := emu.initRAM(opts); err != nil {
+		return err
+	}
 
 	emu.Mem.mapper.init(emu)
+
+	if props, ok := lookupCartProperties(cart); ok {
+		emu.applyCartProperties(props)
+	}
+	emu.applyOptions(opts)
+
+	return nil
+}
+
+func (emu *emuState) applyCartProperties(props CartProperties) {
+	emu.cartProps = props
+	emu.cartPropsKnown = true
+
+	if props.Mapper != "" {
+		emu.Mem.MapperPinned = true
+	}
+
+	emu.setControllers(props.LeftController, props.RightController)
+	emu.PaddleRangeMin = props.PaddleMin
+	emu.PaddleRangeMax = props.PaddleMax
+
+	if props.DisplayStartLine != 0 {
+		emu.TIA.DisplayStartLine = props.DisplayStartLine
+	}
+	if props.TVFormatKnown {
+		emu.setTVFormat(props.TVFormat)
+	}
+}
+
+func (emu *emuState) applyOptions(opts Options) {
+	if opts.LeftController != ControllerAuto || opts.RightController != ControllerAuto {
+		emu.setControllers(opts.LeftController, opts.RightController)
+	}
+	if opts.ForceTVFormat {
+		emu.setTVFormat(opts.TVFormat)
+	}
+}
+
+func (emu *emuState) setControllers(left, right ControllerType) {
+	if left == ControllerAuto && right == ControllerAuto {
+		return
+	}
+	emu.ControllersKnown = true
+	emu.InputPotsBeingUsed = left == ControllerPaddles || right == ControllerPaddles
+	emu.EverSelectedKeypad0 = left == ControllerKeypad
+	emu.EverSelectedKeypad1 = right == ControllerKeypad
 }
 
-func newState(cart []byte, devMode bool) *emuState {
+func (emu *emuState) setTVFormat(format TVFormat) {
+	emu.TIA.setTVFormat(format)
+	emu.APU.setClocksPerSample(format)
+}
+
+func (emu *emuState) initRAM(opts Options) error {
+	switch opts.RAMInit {
+	case RAMInitRandom:
+		emu.RNG.read(emu.Mem.RAM[:])
+	case RAMInitZero:
+		emu.Mem.RAM = [128]byte{}
+	case RAMInitPattern:
+		if len(opts.RAMPattern) == 0 {
+			return fmt.Errorf("RAMInitPattern needs a RAMPattern")
+		}
+		for i := range emu.Mem.RAM {
+			emu.Mem.RAM[i] = opts.RAMPattern[i%len(opts.RAMPattern)]
+		}
+	default:
+		return fmt.Errorf("unknown RAMInit %d", opts.RAMInit)
+	}
+	return nil
+}
+
+func newState(cart []byte, opts Options) (*emuState, error) {
 	var emu emuState
 
-	initEmuState(&emu, cart, devMode)
+	if len(cart) == 0 {
+		return nil, fmt.Errorf("%w: empty cart", ErrBadROM)
+	}
 
-	if devMode {
-		fmt.Println("ROM Size:", len(emu.Mem.rom))
-		fmt.Printf("Mapper: 0x%02x\n", emu.Mem.mapper.getMapperNum())
+	if isWAV(cart) {
+		loads, err := decodeARTape(cart)
+		if err != nil {
+			return nil, err
+		}
+		cart = loads
+	}
+
+	if err := initEmuState(&emu, cart, opts); err != nil {
+		return nil, err
+	}
+	if err := validateMapper(&emu); err != nil {
+		return nil, err
+	}
+
+	emu.logf(LogDebug, LogCart, "ROM Size: %d", len(emu.Mem.rom))
+	emu.logf(LogDebug, LogCart, "Mapper: 0x%02x", emu.Mem.mapper.getMapperNum())
+	if emu.cartPropsKnown {
+		emu.logf(LogInfo, LogCart, "Cart: %s", emu.cartProps.Name)
+	}
+
+	if emu.TIA.FormatSet || opts.SkipTVFormatDetect {
+		return &emu, nil
 	}
 
 	tvFormat := discoverTVFormat(&emu)
-	fmt.Println()
+	if emu.err != nil {
+		return nil, emu.err
+	}
 
 	// start fresh with correct format
-	initEmuState(&emu, cart, devMode)
-	emu.TIA.setTVFormat(tvFormat)
+	initEmuState(&emu, cart, opts)
+	emu.setTVFormat(tvFormat)
 
-	return &emu
+	return &emu, nil
 }
 
+// a couple seconds of the longest (PAL) frames
+const tvFormatDetectCycles = 2 * 50 * 312 * cpuCyclesPerScanline
+
 // discoverTVFormat runs a headless version of emulation for
 // a few frames and returns whether it thinks its PAL or not
 func discoverTVFormat(emu *emuState) TVFormat {
 
-	startTime := time.Now()
-
-	frames := 0
 	nullInput := Input{}
 	emu.DebugContinue = true
-	for !emu.TIA.FormatSet {
-		if time.Now().Sub(startTime) > 2*time.Second {
-			break
-		}
+	for !emu.TIA.FormatSet && emu.err == nil && emu.Cycles < tvFormatDetectCycles {
 		emu.SetInput(nullInput)
 		emu.Step()
-		if emu.FlipRequested() {
-			frames++
-		}
 	}
 	return emu.TIA.TVFormat
 }
 
-func emuErr(args ...interface{}) {
-	fmt.Println(args...)
-	os.Exit(1)
+func (emu *emuState) logf(level LogLevel, category LogCategory, format string, args ...interface{}) {
+	emu.Mem.log.logf(level, category, format, args...)
+}
+
+func (emu *emuState) setLogSink(log *logSink) {
+	emu.Mem.log = log
+	emu.TIA.log = log
+}
+
+// halt stops emulation, keeping the first error seen
+func (emu *emuState) halt(category LogCategory, err error) {
+	if emu.err == nil {
+		emu.err = err
+		emu.logf(LogError, category, "halted: %v", err)
+	}
+}
+
+func (emu *emuState) cpuErr(err error) {
+	if strings.HasPrefix(err.Error(), "kil opcode") {
+		emu.halt(LogCPU, fmt.Errorf("%w at 0x%04x: %v", ErrCPUJam, emu.CPU.PC, err))
+	} else {
+		emu.halt(LogCPU, fmt.Errorf("%w: %v", ErrUnimplemented, err))
+	}
 }